@@ -0,0 +1,198 @@
+package go_mod
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	golang "github.com/bazelbuild/bazel-gazelle/language/go"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"golang.org/x/mod/modfile"
+)
+
+// defaultTargetName is the name of generated go_mod rules, unless
+// # gazelle:go_mod_name says otherwise.
+const defaultTargetName = "go_mod_zip"
+
+// goModConfig holds the go_mod directives in effect for a directory. Every
+// directive is inherited by subdirectories:
+//
+//	# gazelle:go_mod_publish false             generate no go_mod rule
+//	# gazelle:go_mod_name <target>             name the go_mod rule <target>
+//	# gazelle:go_mod_path <module path>        override the go.mod module path
+//	# gazelle:go_mod_exclude <glob>            leave matching paths out of the archive
+//	# gazelle:go_mod_prefix <module path>      module path for go.mod files without one
+//
+// go_mod_path and go_mod_prefix name the module of the directory they appear
+// in; modules below it get the path of their directory appended, like
+// gazelle's own go prefix.
+type goModConfig struct {
+	publish bool
+	name    string
+	// path and prefix, and the directory each was set in
+	path, pathRel     string
+	prefix, prefixRel string
+	exclude           []string
+	// module is the path of the closest module at or above the directory,
+	// and moduleRel where its go.mod is
+	module, moduleRel string
+}
+
+func getGoModConfig(c *config.Config) *goModConfig {
+	if gc, ok := c.Exts[goModName].(*goModConfig); ok {
+		return gc
+	}
+	return &goModConfig{publish: true, name: defaultTargetName}
+}
+
+func (*GoMod) KnownDirectives() []string {
+	return []string{"go_mod_publish", "go_mod_name", "go_mod_path", "go_mod_exclude", "go_mod_prefix"}
+}
+
+func (*GoMod) Configure(c *config.Config, rel string, f *rule.File) {
+	// copy, so the directives of this directory don't leak into its siblings
+	gc := *getGoModConfig(c)
+	gc.exclude = slices.Clone(gc.exclude)
+
+	if f != nil {
+		for _, d := range f.Directives {
+			value := strings.TrimSpace(d.Value)
+			switch d.Key {
+			case "go_mod_publish":
+				publish, err := strconv.ParseBool(value)
+				if err != nil {
+					log.Printf("%s: invalid go_mod_publish %q, expected true or false", f.Path, d.Value)
+					continue
+				}
+				gc.publish = publish
+			case "go_mod_name":
+				gc.name = value
+				if gc.name == "" {
+					gc.name = defaultTargetName
+				}
+			case "go_mod_path":
+				gc.path, gc.pathRel = value, rel
+			case "go_mod_prefix":
+				gc.prefix, gc.prefixRel = value, rel
+			case "go_mod_exclude":
+				if value != "" {
+					gc.exclude = append(gc.exclude, value)
+				}
+			}
+		}
+	}
+
+	if module, ok := gc.readModule(c, rel); ok {
+		gc.module, gc.moduleRel = module, rel
+		setGoPrefix(c, f, rel, module)
+	}
+
+	c.Exts[goModName] = &gc
+}
+
+// readModule returns the module path of the go.mod in rel, if there is one
+// and it can be read.
+func (gc *goModConfig) readModule(c *config.Config, rel string) (string, bool) {
+	goModPath := filepath.Join(c.RepoRoot, filepath.FromSlash(rel), "go.mod")
+	if _, err := os.Stat(goModPath); err != nil {
+		return "", false
+	}
+	mf, err := readGoMod(goModPath)
+	if err != nil {
+		// GenerateRules reports it
+		return "", false
+	}
+	module, err := gc.modulePath(rel, mf)
+	return module, err == nil
+}
+
+// setGoPrefix makes the module path the go prefix of rel, so the importpaths
+// gazelle's go extension generates below a go.mod are the module path plus
+// the directory. It adds a prefix directive to f, which the go extension
+// reads when it configures the same directory after us; see the languages
+// of //:gazelle_binary. An explicit # gazelle:prefix wins.
+//
+// The go extension only reads directives from a BUILD file, so when rel has
+// none yet it is configured here from one holding just the prefix; its own
+// Configure then inherits that, and the BUILD file generated on this run
+// already has the module's importpaths.
+func setGoPrefix(c *config.Config, f *rule.File, rel, module string) {
+	if f == nil {
+		synthetic := rule.EmptyFile(path.Join(rel, "BUILD.bazel"), rel)
+		synthetic.Directives = []rule.Directive{{Key: "prefix", Value: module}}
+		golang.NewLanguage().Configure(c, rel, synthetic)
+		return
+	}
+	for _, d := range f.Directives {
+		if d.Key == "prefix" {
+			return
+		}
+	}
+	f.Directives = append(f.Directives, rule.Directive{Key: "prefix", Value: module})
+}
+
+// importpathMismatches describes every rule of f in rel whose importpath is
+// kept, with # keep, and is not its module path plus its directory. The go
+// extension merges importpath, so the ones it generated from an older prefix
+// are rewritten from the one setGoPrefix sets and need no report.
+func (gc *goModConfig) importpathMismatches(f *rule.File, rel string) []string {
+	if f == nil || gc.module == "" {
+		return nil
+	}
+	want := inheritPath(gc.module, gc.moduleRel, rel)
+
+	var mismatches []string
+	for _, r := range f.Rules {
+		importpath := r.AttrString("importpath")
+		if importpath == "" || importpath == want || !keepsAttr(r, "importpath") {
+			continue
+		}
+		mismatches = append(mismatches, fmt.Sprintf("//%s:%s keeps importpath %s, but module %s puts the package at %s", rel, r.Name(), importpath, gc.module, want))
+	}
+	return mismatches
+}
+
+// keepsAttr reports whether a # keep comment on r, on its key attribute or
+// on the attribute's value stops gazelle from merging the attribute.
+func keepsAttr(r *rule.Rule, key string) bool {
+	if r.ShouldKeep() || rule.ShouldKeep(r.Attr(key)) {
+		return true
+	}
+	c := r.AttrComments(key)
+	for _, comment := range append(c.Before, c.Suffix...) {
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Token, "#"))
+		if text == "keep" || strings.HasPrefix(text, "keep: ") {
+			return true
+		}
+	}
+	return false
+}
+
+// modulePath returns the module path of the go.mod in rel: the go_mod_path
+// override, the module directive, or one derived from go_mod_prefix, in that
+// order.
+func (gc *goModConfig) modulePath(rel string, f *modfile.File) (string, error) {
+	switch {
+	case gc.path != "":
+		return inheritPath(gc.path, gc.pathRel, rel), nil
+	case f.Module != nil && f.Module.Mod.Path != "":
+		return f.Module.Mod.Path, nil
+	case gc.prefix != "":
+		return inheritPath(gc.prefix, gc.prefixRel, rel), nil
+	}
+	return "", fmt.Errorf("no module directive, and no go_mod_prefix to derive the module path from")
+}
+
+// inheritPath appends rel's path below baseRel to base.
+func inheritPath(base, baseRel, rel string) string {
+	if baseRel != "" {
+		rel = strings.TrimPrefix(strings.TrimPrefix(rel, baseRel), "/")
+	}
+	return path.Join(base, rel)
+}
@@ -0,0 +1,214 @@
+package go_mod
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	golang "github.com/bazelbuild/bazel-gazelle/language/go"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/bazelbuild/bazel-gazelle/testtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoMod_Directives(t *testing.T) {
+	// repo/                go_mod_prefix example.com/repo, go_mod_exclude testdata
+	//   a/go.mod           no module directive
+	//   b/                 go_mod_name module, go_mod_exclude *.md
+	//     c/go.mod
+	//   d/                 go_mod_path example.com/override
+	//     go.mod
+	//     e/go.mod
+	//   private/           go_mod_publish false
+	//     f/go.mod
+	files := []testtools.FileSpec{
+		{Path: "a/go.mod", Content: "go 1.23\n"},
+		{Path: "b/c/go.mod", Content: "module example.com/elsewhere/c\n"},
+		{Path: "d/go.mod", Content: "module example.com/repo/d\n"},
+		{Path: "d/e/go.mod", Content: "module example.com/repo/d/e\n"},
+		{Path: "private/f/go.mod", Content: "module example.com/repo/private/f\n"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	directives := map[string][]rule.Directive{
+		"": {
+			{Key: "go_mod_prefix", Value: "example.com/repo"},
+			{Key: "go_mod_exclude", Value: "testdata"},
+		},
+		"b": {
+			{Key: "go_mod_name", Value: "module"},
+			{Key: "go_mod_exclude", Value: "*.md"},
+		},
+		"d":       {{Key: "go_mod_path", Value: "example.com/override"}},
+		"private": {{Key: "go_mod_publish", Value: "false"}},
+	}
+
+	ext := NewLanguage().(*GoMod)
+
+	// configure returns the configuration of rel, applying the directives
+	// of every directory from the root down, as gazelle's walk does
+	configure := func(rel string) *config.Config {
+		c := config.New()
+		dirs := []string{""}
+		for i, r := range rel {
+			if r == '/' {
+				dirs = append(dirs, rel[:i])
+			}
+		}
+		if rel != "" {
+			dirs = append(dirs, rel)
+		}
+		for _, d := range dirs {
+			c = c.Clone()
+			ext.Configure(c, d, &rule.File{Path: filepath.Join(d, "BUILD.bazel"), Directives: directives[d]})
+		}
+		return c
+	}
+
+	generate := func(rel string) language.GenerateResult {
+		return ext.GenerateRules(language.GenerateArgs{
+			Config:       configure(rel),
+			Dir:          filepath.Join(dir, rel),
+			Rel:          rel,
+			RegularFiles: []string{"go.mod"},
+		})
+	}
+
+	tests := []struct {
+		rel         string
+		wantName    string
+		wantPath    string
+		wantExclude []string
+	}{
+		{rel: "a", wantName: "go_mod_zip", wantPath: "example.com/repo/a", wantExclude: []string{"testdata"}},
+		{rel: "b/c", wantName: "module", wantPath: "example.com/elsewhere/c", wantExclude: []string{"testdata", "*.md"}},
+		{rel: "d", wantName: "go_mod_zip", wantPath: "example.com/override", wantExclude: []string{"testdata"}},
+		{rel: "d/e", wantName: "go_mod_zip", wantPath: "example.com/override/e", wantExclude: []string{"testdata"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			res := generate(tt.rel)
+			require.Len(t, res.Gen, 2)
+			r := res.Gen[0]
+			assert.Equal(t, tt.wantName, r.Name())
+			assert.Equal(t, tt.wantPath, r.AttrString("module_path"))
+			assert.Equal(t, tt.wantExclude, r.AttrStrings("exclude"))
+			assert.Equal(t, tt.wantName+"_test", res.Gen[1].Name())
+			assert.Equal(t, ":"+tt.wantName, res.Gen[1].AttrString("go_mod"))
+		})
+	}
+
+	t.Run("private/f", func(t *testing.T) {
+		res := ext.GenerateRules(language.GenerateArgs{
+			Config:       configure("private/f"),
+			Dir:          filepath.Join(dir, "private/f"),
+			Rel:          "private/f",
+			File:         &rule.File{Rules: []*rule.Rule{rule.NewRule("go_mod", "go_mod_zip"), rule.NewRule("go_mod_test", "go_mod_zip_test")}},
+			RegularFiles: []string{"go.mod"},
+		})
+		assert.Empty(t, res.Gen)
+		require.Len(t, res.Empty, 2)
+		assert.Equal(t, "go_mod_zip", res.Empty[0].Name())
+		assert.Equal(t, "go_mod_zip_test", res.Empty[1].Name())
+	})
+
+	t.Run("siblings don't share directives", func(t *testing.T) {
+		gc := getGoModConfig(configure("a"))
+		assert.Equal(t, []string{"testdata"}, gc.exclude)
+		assert.True(t, gc.publish)
+	})
+}
+
+func TestGoMod_Configure_GoPrefix(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "mod/go.mod", Content: "module example.com/mod\n"},
+		{Path: "mod/nested/go.mod", Content: "module example.com/nested\n"},
+		{Path: "explicit/go.mod", Content: "module example.com/explicit\n"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	ext := NewLanguage().(*GoMod)
+	root := config.New()
+	root.RepoRoot = dir
+	ext.Configure(root, "", &rule.File{})
+
+	configure := func(parent *config.Config, rel string, f *rule.File) *config.Config {
+		c := parent.Clone()
+		ext.Configure(c, rel, f)
+		return c
+	}
+
+	t.Run("a go.mod sets the go prefix of its directory", func(t *testing.T) {
+		f := &rule.File{}
+		configure(root, "mod", f)
+		assert.Equal(t, []rule.Directive{{Key: "prefix", Value: "example.com/mod"}}, f.Directives)
+	})
+
+	t.Run("an explicit prefix directive wins", func(t *testing.T) {
+		f := &rule.File{Directives: []rule.Directive{{Key: "prefix", Value: "example.com/custom"}}}
+		configure(root, "explicit", f)
+		assert.Equal(t, []rule.Directive{{Key: "prefix", Value: "example.com/custom"}}, f.Directives)
+	})
+
+	t.Run("directories without a go.mod are left alone", func(t *testing.T) {
+		f := &rule.File{}
+		configure(configure(root, "mod", &rule.File{}), "mod/pkg", f)
+		assert.Empty(t, f.Directives)
+	})
+
+	t.Run("a go.mod without a BUILD file sets the go prefix too", func(t *testing.T) {
+		goLang := golang.NewLanguage()
+		c := root.Clone()
+		goLang.Configure(c, "", &rule.File{})
+		configureBoth := func(parent *config.Config, rel string) *config.Config {
+			c := parent.Clone()
+			ext.Configure(c, rel, nil)
+			goLang.Configure(c, rel, nil)
+			return c
+		}
+
+		pkg := configureBoth(configureBoth(c, "mod"), "mod/pkg")
+		assert.Equal(t, "example.com/mod/pkg", golang.InferImportPath(pkg, "mod/pkg"))
+	})
+
+	t.Run("kept importpaths that disagree with the module are reported", func(t *testing.T) {
+		mod := configure(root, "mod", &rule.File{})
+		nested := configure(configure(mod, "mod/nested", &rule.File{}), "mod/nested/pkg", &rule.File{})
+
+		f, err := rule.LoadData("mod/nested/pkg/BUILD.bazel", "mod/nested/pkg", []byte(`
+go_library(
+    name = "pkg",
+    importpath = "example.com/mod/nested/pkg",  # keep
+)
+
+# keep
+go_library(
+    name = "kept",
+    importpath = "example.com/elsewhere/pkg",
+)
+
+go_library(
+    name = "stale",
+    importpath = "example.com/mod/nested/pkg",
+)
+
+go_library(
+    name = "other",
+    importpath = "example.com/nested/pkg",  # keep
+)
+
+go_test(name = "pkg_test")
+`))
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{
+			"//mod/nested/pkg:pkg keeps importpath example.com/mod/nested/pkg, but module example.com/nested puts the package at example.com/nested/pkg",
+			"//mod/nested/pkg:kept keeps importpath example.com/elsewhere/pkg, but module example.com/nested puts the package at example.com/nested/pkg",
+		}, getGoModConfig(nested).importpathMismatches(f, "mod/nested/pkg"))
+	})
+}
@@ -1,12 +1,20 @@
 package go_mod
 
 import (
+	"log"
+	"os"
 	"path"
+	"path/filepath"
 	"slices"
+	"strings"
 
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/resolve"
 	"github.com/bazelbuild/bazel-gazelle/rule"
+	"golang.org/x/mod/modfile"
 )
 
 // to understand whats going on here please read:
@@ -16,14 +24,36 @@ import (
 type GoMod struct {
 	language.BaseLang
 	// see: https://github.com/bazel-contrib/bazel-gazelle/blob/master/language/base.go
+
+	// packages visited so far that no go.mod has claimed yet, see GenerateRules
+	unclaimed []string
+}
+
+// module_files indexes each _pkg_ filegroup it generates under its package,
+// see ModuleFiles.Imports in gazelle_languages/module_files.
+const (
+	moduleFilesLang   = "module_files"
+	moduleFilesTarget = "_pkg_"
+)
+
+// goModImports is what GenerateRules hands to Resolve for a go_mod rule.
+type goModImports struct {
+	// packages whose _pkg_ filegroups make up the module
+	pkgs []string
+	// module paths the go.mod requires
+	requires []string
 }
 
 func NewLanguage() language.Language {
 	return &GoMod{}
 }
 
+// goModName is the name of the extension, and the key of its configuration
+// in config.Config.Exts.
+const goModName = "go_mod"
+
 func (*GoMod) Name() string {
-	return "go_mod"
+	return goModName
 }
 
 // returns the kinds of rules this extension generates.
@@ -32,7 +62,13 @@ func (*GoMod) Kinds() map[string]rule.KindInfo {
 		"go_mod": {
 			MatchAny:       true,
 			NonEmptyAttrs:  map[string]bool{"srcs": true},
-			MergeableAttrs: map[string]bool{"srcs": true},
+			MergeableAttrs: map[string]bool{"srcs": true, "deps": true, "exclude": true, "go_mod": true, "module_path": true},
+			ResolveAttrs:   map[string]bool{"srcs": true, "deps": true},
+		},
+		"go_mod_test": {
+			MatchAttrs:     []string{"go_mod"},
+			NonEmptyAttrs:  map[string]bool{"go_mod": true},
+			MergeableAttrs: map[string]bool{"go_mod": true},
 		},
 	}
 }
@@ -42,47 +78,172 @@ func (*GoMod) Loads() []rule.LoadInfo {
 	return []rule.LoadInfo{
 		{
 			Name:    "@bazel-go-mod-experiment//rules:go_mod.bzl",
-			Symbols: []string{"go_mod"},
+			Symbols: []string{"go_mod", "go_mod_test"},
 		},
 	}
 }
 
 // generates rules for go.mod files in a given bazel package
-func (*GoMod) GenerateRules(args language.GenerateArgs) language.GenerateResult {
+//
+// note: this relies on gazelle's depth-first post-order traversal. Every
+// package without a go.mod is remembered until the closest go.mod above it
+// claims it, so a module picks up descendants at any depth, while the subtree
+// of a nested module has already been claimed by the time its parent is
+// generated.
+func (gm *GoMod) GenerateRules(args language.GenerateArgs) language.GenerateResult {
 	var res language.GenerateResult
 
+	for _, m := range getGoModConfig(args.Config).importpathMismatches(args.File, args.Rel) {
+		log.Print(m)
+	}
+
 	if !slices.Contains(args.RegularFiles, "go.mod") {
-		// no go.mod, no work to be done
+		// no go.mod, the package belongs to the closest module above it, and
+		// any go_mod rule left over from a deleted or moved go.mod goes
+		gm.unclaimed = append(gm.unclaimed, args.Rel)
+		res.Empty = staleRules(args.File)
 		return res
 	}
 
-	// _pkg_ is provided by gazelle/languages/module_files
-	srcs := []string{":_pkg_"}
+	// the packages whose _pkg_ filegroups make up the module; Resolve keeps
+	// the ones module_files generated a filegroup for, since empty and
+	// excluded directories have none
+	//
+	// this happens before go.mod is parsed: even a broken go.mod bounds the
+	// module, and its subtree must not leak into the parent module.
+	pkgs := append([]string{args.Rel}, gm.claim(args.Rel)...)
+
+	gc := getGoModConfig(args.Config)
+	if !gc.publish {
+		// # gazelle:go_mod_publish false, remove the rules if there are any
+		res.Empty = staleRules(args.File)
+		return res
+	}
 
-	for _, f := range args.Subdirs {
-		// TODO: this can cause a crash today for various reasons including: when
-		// module_files ignores a folder because it contains module_file_exclude
-		// files The solution is to either, or the folder is empty...
-		//
-		// This will require some additional investigation, but I'll leave some
-		// notes for myself:
-		//
-		// * combine module_files and go_mod - this currently preferred, but knowing when
-		//   to generate the child filegroups because they are contained by a go.mod
-		//   is unclear to me
-		// * make go_mod be able to cross-resolve with module_files
-		pkg := path.Join(args.Rel, f)
-		srcs = append(srcs, "//"+pkg+":_pkg_")
+	var modulePath string
+	mf, err := readGoMod(filepath.Join(args.Dir, "go.mod"))
+	if err == nil {
+		modulePath, err = gc.modulePath(args.Rel, mf)
+	}
+	if err != nil {
+		// a broken go.mod would produce a broken rule, so leave the package alone
+		log.Printf("%s: skipping go_mod rule: %v", path.Join(args.Rel, "go.mod"), err)
+		return res
 	}
 
-	r := rule.NewRule("go_mod", "go_mod_zip")
+	r := rule.NewRule("go_mod", gc.name)
 
 	r.SetAttr("go_mod", ":go.mod")
-	r.SetAttr("srcs", srcs)
-	r.SetAttr("module_path", args.Rel)
+	r.SetAttr("module_path", modulePath)
+	if len(gc.exclude) > 0 {
+		r.SetAttr("exclude", gc.exclude)
+	}
+
+	var requires []string
+	for _, req := range mf.Require {
+		requires = append(requires, req.Mod.Path)
+	}
+
+	// checks the archive actually holds what the go_mod rule was given
+	t := rule.NewRule("go_mod_test", gc.name+"_test")
+	t.SetAttr("go_mod", ":"+gc.name)
 
-	res.Gen = append(res.Gen, r)
-	res.Imports = append(res.Imports, []resolve.ImportSpec{})
+	res.Gen = append(res.Gen, r, t)
+	// rules under an earlier go_mod_name
+	res.Empty = staleRules(args.File, r.Name(), t.Name())
+	res.Imports = append(res.Imports, goModImports{pkgs: pkgs, requires: requires}, nil)
 
 	return res
 }
+
+// staleRules returns an empty rule for every go_mod and go_mod_test rule of f
+// not named in keep, so gazelle deletes them.
+func staleRules(f *rule.File, keep ...string) []*rule.Rule {
+	if f == nil {
+		return nil
+	}
+	var empty []*rule.Rule
+	for _, r := range f.Rules {
+		if (r.Kind() == "go_mod" || r.Kind() == "go_mod_test") && !slices.Contains(keep, r.Name()) {
+			empty = append(empty, rule.NewRule(r.Kind(), r.Name()))
+		}
+	}
+	return empty
+}
+
+// claim removes the unclaimed packages below rel and returns them, sorted.
+func (gm *GoMod) claim(rel string) []string {
+	var claimed []string
+	unclaimed := gm.unclaimed[:0]
+	for _, pkg := range gm.unclaimed {
+		if rel == "" || strings.HasPrefix(pkg, rel+"/") {
+			claimed = append(claimed, pkg)
+		} else {
+			unclaimed = append(unclaimed, pkg)
+		}
+	}
+	gm.unclaimed = unclaimed
+	slices.Sort(claimed)
+	return claimed
+}
+
+// Imports indexes go_mod rules by their module path, so the go_mod rules of
+// modules requiring them can depend on them.
+func (gm *GoMod) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+	modulePath := r.AttrString("module_path")
+	if r.Kind() != "go_mod" || modulePath == "" {
+		return nil
+	}
+	return []resolve.ImportSpec{{Lang: gm.Name(), Imp: modulePath}}
+}
+
+// Resolve sets srcs to the _pkg_ filegroups module_files generated for the
+// packages GenerateRules collected, and deps to the go_mod rules of the
+// in-repo modules the go.mod requires. Requirements on modules outside the
+// repo have no go_mod rule and are left out.
+func (gm *GoMod) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imports interface{}, from label.Label) {
+	if r.Kind() != "go_mod" {
+		return
+	}
+	imps, _ := imports.(goModImports)
+
+	var srcs []string
+	for _, pkg := range imps.pkgs {
+		spec := resolve.ImportSpec{Lang: moduleFilesLang, Imp: pkg}
+		for _, m := range ix.FindRulesByImportWithConfig(c, spec, moduleFilesLang) {
+			if m.Label.Name == moduleFilesTarget {
+				srcs = append(srcs, m.Label.Rel(from.Repo, from.Pkg).String())
+			}
+		}
+	}
+
+	setOrDelete(r, "srcs", srcs)
+
+	var deps []string
+	for _, modulePath := range imps.requires {
+		spec := resolve.ImportSpec{Lang: gm.Name(), Imp: modulePath}
+		for _, m := range ix.FindRulesByImportWithConfig(c, spec, gm.Name()) {
+			if m.Label != from {
+				deps = append(deps, m.Label.Rel(from.Repo, from.Pkg).String())
+			}
+		}
+	}
+	slices.Sort(deps)
+	setOrDelete(r, "deps", slices.Compact(deps))
+}
+
+func setOrDelete(r *rule.Rule, key string, values []string) {
+	if len(values) == 0 {
+		r.DelAttr(key)
+		return
+	}
+	r.SetAttr(key, values)
+}
+
+func readGoMod(goModPath string) (*modfile.File, error) {
+	data, err := os.ReadFile(goModPath)
+	if err != nil {
+		return nil, err
+	}
+	return modfile.ParseLax(goModPath, data, nil)
+}
@@ -0,0 +1,298 @@
+package go_mod
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/bazelbuild/bazel-gazelle/testtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoMod_GenerateRules_ModulePath(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "mod_a/go.mod", Content: "module github.com/example/repo/mod_a\n\ngo 1.23\n"},
+		{Path: "broken/go.mod", Content: "module github.com/example/repo/broken\n\nrequire (\n"},
+		{Path: "empty/go.mod", Content: "go 1.23\n"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	ext := NewLanguage().(*GoMod)
+	generate := func(rel string) language.GenerateResult {
+		return ext.GenerateRules(language.GenerateArgs{
+			Config:       &config.Config{},
+			Dir:          filepath.Join(dir, rel),
+			Rel:          rel,
+			RegularFiles: []string{"go.mod"},
+		})
+	}
+
+	res := generate("mod_a")
+	require.Len(t, res.Gen, 2)
+	assert.Equal(t, "go_mod", res.Gen[0].Kind())
+	assert.Equal(t, "github.com/example/repo/mod_a", res.Gen[0].AttrString("module_path"))
+
+	// every module gets a test of its archive
+	assert.Equal(t, "go_mod_test", res.Gen[1].Kind())
+	assert.Equal(t, "go_mod_zip_test", res.Gen[1].Name())
+	assert.Equal(t, ":go_mod_zip", res.Gen[1].AttrString("go_mod"))
+
+	// malformed go.mod files are reported and produce no rule
+	assert.Empty(t, generate("broken").Gen)
+	assert.Empty(t, generate("empty").Gen)
+}
+
+// moduleFilesIndexer indexes _pkg_ filegroups the way module_files does.
+type moduleFilesIndexer struct {
+	language.BaseLang
+}
+
+func (*moduleFilesIndexer) Name() string { return moduleFilesLang }
+
+func (*moduleFilesIndexer) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+	return []resolve.ImportSpec{{Lang: moduleFilesLang, Imp: f.Pkg}}
+}
+
+func TestGoMod_Resolve_Srcs(t *testing.T) {
+	// mod/
+	//   go.mod
+	//   pkg/lib.go
+	//   empty/          no files, so no _pkg_
+	//   excluded/       only module_files_exclude'd files, so no _pkg_
+	files := []testtools.FileSpec{
+		{Path: "mod/go.mod", Content: "module github.com/example/repo/mod\n\ngo 1.23\n"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	c := &config.Config{IndexLibraries: true}
+	ext := NewLanguage().(*GoMod)
+	for _, rel := range []string{"mod/empty", "mod/excluded", "mod/pkg"} {
+		ext.GenerateRules(language.GenerateArgs{Config: c, Dir: filepath.Join(dir, rel), Rel: rel})
+	}
+	res := ext.GenerateRules(language.GenerateArgs{
+		Config:       c,
+		Dir:          filepath.Join(dir, "mod"),
+		Rel:          "mod",
+		Subdirs:      []string{"empty", "excluded", "pkg"},
+		RegularFiles: []string{"go.mod"},
+	})
+	require.Len(t, res.Gen, 2)
+	require.Len(t, res.Imports, 2)
+
+	tests := []struct {
+		name    string
+		indexed []string
+		want    []string
+	}{
+		{
+			name:    "only packages with a _pkg_ filegroup are referenced",
+			indexed: []string{"mod", "mod/pkg"},
+			want:    []string{":_pkg_", "//mod/pkg:_pkg_"},
+		},
+		{
+			name:    "filegroups outside the module are ignored",
+			indexed: []string{"mod", "other"},
+			want:    []string{":_pkg_"},
+		},
+		{
+			name:    "no filegroups at all",
+			indexed: nil,
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := &moduleFilesIndexer{}
+			ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return indexer })
+			for _, pkg := range tt.indexed {
+				ix.AddRule(c, rule.NewRule("filegroup", moduleFilesTarget), &rule.File{Pkg: pkg})
+			}
+			ix.Finish()
+
+			r := res.Gen[0]
+			ext.Resolve(c, ix, nil, r, res.Imports[0], label.New("", "mod", r.Name()))
+			assert.Equal(t, tt.want, r.AttrStrings("srcs"))
+		})
+	}
+}
+
+func TestGoMod_GenerateRules_NestedModules(t *testing.T) {
+	// root/
+	//   go.mod
+	//   a/b/c/          several levels below, no go.mod
+	//   nested/
+	//     go.mod
+	//     sub/
+	//   other/          a sibling outside the module
+	files := []testtools.FileSpec{
+		{Path: "root/go.mod", Content: "module example.com/root\n"},
+		{Path: "root/nested/go.mod", Content: "module example.com/root/nested\n"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	ext := NewLanguage().(*GoMod)
+	generate := func(rel string, files ...string) language.GenerateResult {
+		return ext.GenerateRules(language.GenerateArgs{
+			Config:       &config.Config{},
+			Dir:          filepath.Join(dir, rel),
+			Rel:          rel,
+			RegularFiles: files,
+		})
+	}
+
+	// post-order, as gazelle walks
+	generate("root/a/b/c", "c.go")
+	generate("root/a/b")
+	generate("root/a", "a.go")
+	generate("root/nested/sub", "sub.go")
+	nested := generate("root/nested", "go.mod")
+	root := generate("root", "go.mod")
+	generate("other", "other.go")
+
+	require.Len(t, nested.Imports, 2)
+	assert.Equal(t, []string{"root/nested", "root/nested/sub"}, nested.Imports[0].(goModImports).pkgs)
+	require.Len(t, root.Imports, 2)
+	assert.Equal(t, []string{"root", "root/a", "root/a/b", "root/a/b/c"}, root.Imports[0].(goModImports).pkgs)
+	assert.Equal(t, []string{"other"}, ext.unclaimed)
+}
+
+func TestGoMod_Resolve_Deps(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "mod_a/go.mod", Content: `module example.com/repo/mod_a
+
+require (
+	example.com/repo/mod_b v0.0.0
+	example.com/repo/mod_c v0.0.0 // indirect
+	github.com/external/dep v1.2.3
+)
+
+replace example.com/repo/mod_b => ../mod_b/
+`},
+		{Path: "mod_b/go.mod", Content: "module example.com/repo/mod_b\n"},
+		{Path: "nested/mod_c/go.mod", Content: "module example.com/repo/mod_c\n"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	c := &config.Config{IndexLibraries: true}
+	ext := NewLanguage().(*GoMod)
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return ext })
+
+	generated := map[string]language.GenerateResult{}
+	for _, rel := range []string{"mod_a", "mod_b", "nested/mod_c"} {
+		res := ext.GenerateRules(language.GenerateArgs{
+			Config:       c,
+			Dir:          filepath.Join(dir, rel),
+			Rel:          rel,
+			RegularFiles: []string{"go.mod"},
+		})
+		require.Len(t, res.Gen, 2)
+		ix.AddRule(c, res.Gen[0], &rule.File{Pkg: rel})
+		generated[rel] = res
+	}
+	ix.Finish()
+
+	tests := []struct {
+		rel  string
+		want []string
+	}{
+		// the external requirement has no go_mod rule
+		{rel: "mod_a", want: []string{"//mod_b:go_mod_zip", "//nested/mod_c:go_mod_zip"}},
+		{rel: "mod_b", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			res := generated[tt.rel]
+			r := res.Gen[0]
+			ext.Resolve(c, ix, nil, r, res.Imports[0], label.New("", tt.rel, r.Name()))
+			assert.Equal(t, tt.want, r.AttrStrings("deps"))
+		})
+	}
+}
+
+func TestGoMod_GenerateRules_StaleRules(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "mod/go.mod", Content: "module example.com/mod\n"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	existing := func(names ...string) *rule.File {
+		f := &rule.File{}
+		for _, name := range names {
+			kind := "go_mod"
+			if strings.HasSuffix(name, "_test") {
+				kind = "go_mod_test"
+			}
+			f.Rules = append(f.Rules, rule.NewRule(kind, name))
+		}
+		// rules of other kinds are never touched
+		f.Rules = append(f.Rules, rule.NewRule("sh_test", "go_mod_test"))
+		return f
+	}
+
+	tests := []struct {
+		name      string
+		rel       string
+		files     []string
+		existing  *rule.File
+		wantGen   []string
+		wantEmpty []string
+	}{
+		{
+			name:      "go.mod deleted",
+			rel:       "old",
+			files:     []string{"lib.go"},
+			existing:  existing("go_mod_zip", "go_mod_zip_test"),
+			wantEmpty: []string{"go_mod_zip", "go_mod_zip_test"},
+		},
+		{
+			name:    "go.mod still there",
+			rel:     "mod",
+			files:   []string{"go.mod"},
+			wantGen: []string{"go_mod_zip", "go_mod_zip_test"},
+		},
+		{
+			name:      "targets renamed",
+			rel:       "mod",
+			files:     []string{"go.mod"},
+			existing:  existing("module", "module_test"),
+			wantGen:   []string{"go_mod_zip", "go_mod_zip_test"},
+			wantEmpty: []string{"module", "module_test"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ext := NewLanguage().(*GoMod)
+			res := ext.GenerateRules(language.GenerateArgs{
+				Config:       &config.Config{},
+				Dir:          filepath.Join(dir, tt.rel),
+				Rel:          tt.rel,
+				File:         tt.existing,
+				RegularFiles: tt.files,
+			})
+			assert.Equal(t, tt.wantGen, ruleNames(res.Gen))
+			assert.Equal(t, tt.wantEmpty, ruleNames(res.Empty))
+		})
+	}
+}
+
+func ruleNames(rules []*rule.Rule) []string {
+	var names []string
+	for _, r := range rules {
+		names = append(names, r.Name())
+	}
+	return names
+}
@@ -2,11 +2,19 @@ module bazel-go-mod-experiment/tools/gazelle_go_mod/tools/gazelle_go_mod
 
 go 1.23.3
 
-require github.com/bazelbuild/bazel-gazelle v0.43.0
+require (
+	github.com/bazelbuild/bazel-gazelle v0.43.0
+	github.com/stretchr/testify v1.9.0
+	golang.org/x/mod v0.20.0
+)
 
 require (
 	github.com/bazelbuild/buildtools v0.0.0-20240918101019-be1c24cc9a44 // indirect
-	golang.org/x/mod v0.20.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/google/go-cmp v0.6.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.25.0 // indirect
 	golang.org/x/tools/go/vcs v0.1.0-deprecated // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,193 @@
+package in_repo_modules
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	golang "github.com/bazelbuild/bazel-gazelle/language/go"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"golang.org/x/mod/modfile"
+)
+
+// to understand whats going on here please read:
+// https://github.com/bazel-contrib/bazel-gazelle/blob/f4f1b2cdee4ac7e452bcf66cadb33429d377965f/language/lang.go#L63
+
+// InRepoModules is gazelle's go extension, with Go imports of packages in
+// in-repo modules always resolved to the local packages.
+//
+// go_deps creates an external repo for every module in go.work, so a dep on
+// one of them can resolve to either the local package or the external copy,
+// and one build can end up with both. Every go.mod of the repo is indexed,
+// and deps pointing at the external repo of an in-repo module are replaced
+// by the local label, with a warning naming the edge.
+//
+// It replaces @gazelle//language/go in gazelle_binary, since gazelle only
+// lets one extension own go_library and friends.
+type InRepoModules struct {
+	language.Language
+
+	// in-repo modules by the name of the external repo go_deps creates for them
+	byRepo map[string]inRepoModule
+}
+
+type inRepoModule struct {
+	path string
+	// rel is the directory of the module's go.mod
+	rel string
+}
+
+func NewLanguage() language.Language {
+	return &InRepoModules{Language: golang.NewLanguage()}
+}
+
+// ApparentLoads forwards to the go extension, which loads rules_go under
+// the name the root module gives it.
+func (l *InRepoModules) ApparentLoads(moduleToApparentName func(string) string) []rule.LoadInfo {
+	if m, ok := l.Language.(language.ModuleAwareLanguage); ok {
+		return m.ApparentLoads(moduleToApparentName)
+	}
+	return l.Language.Loads()
+}
+
+func (l *InRepoModules) Configure(c *config.Config, rel string, f *rule.File) {
+	l.Language.Configure(c, rel, f)
+	if rel != "" || l.byRepo != nil {
+		return
+	}
+
+	modules, err := findModules(c.RepoRoot)
+	if err != nil {
+		log.Printf("failed to index in-repo modules: %v", err)
+	}
+	l.byRepo = map[string]inRepoModule{}
+	for _, m := range modules {
+		// go_deps names repos differently from gazelle's own naming, which
+		// WORKSPACE go_repository rules follow; index both
+		l.byRepo[goDepsRepoName(m.path)] = m
+		l.byRepo[label.ImportPathToBazelRepoName(m.path)] = m
+	}
+}
+
+// goDepsRepoName is the name go_deps gives the repo of the module at
+// importpath, see _repo_name in gazelle's internal/bzlmod/go_deps.bzl: the
+// host reversed, then the path, joined with "_", with every character but
+// letters and digits turned into "_". Unlike label.ImportPathToBazelRepoName
+// it does not collapse runs of them, so github.com/example/-repo becomes
+// com_github_example__repo.
+func goDepsRepoName(importpath string) string {
+	segments := strings.Split(importpath, "/")
+	host := strings.Split(segments[0], ".")
+	slices.Reverse(host)
+	name := strings.Join(append(host, segments[1:]...), "_")
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case 'a' <= r && r <= 'z', '0' <= r && r <= '9':
+			b.WriteRune(r)
+		case 'A' <= r && r <= 'Z':
+			b.WriteRune(r - 'A' + 'a')
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// findModules returns the module of every go.mod below repoRoot, leaving out
+// hidden directories and bazel's output symlinks.
+func findModules(repoRoot string) ([]inRepoModule, error) {
+	var modules []inRepoModule
+	err := filepath.WalkDir(repoRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != repoRoot && (strings.HasPrefix(d.Name(), ".") || strings.HasPrefix(d.Name(), "bazel-")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" {
+			return nil
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		modulePath := modfile.ModulePath(data)
+		if modulePath == "" {
+			// go_mod reports go.mod files it cannot use
+			return nil
+		}
+		rel, err := filepath.Rel(repoRoot, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			rel = ""
+		}
+		modules = append(modules, inRepoModule{path: modulePath, rel: filepath.ToSlash(rel)})
+		return nil
+	})
+	return modules, err
+}
+
+// Resolve resolves deps the way the go extension does, then moves the ones
+// on external copies of in-repo modules to the local packages.
+func (l *InRepoModules) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imports interface{}, from label.Label) {
+	l.Language.Resolve(c, ix, rc, r, imports, from)
+
+	deps := r.AttrStrings("deps")
+	if len(deps) == 0 {
+		return
+	}
+	// the rule may depend on both copies already
+	local := make([]string, 0, len(deps))
+	seen := map[string]bool{}
+	for _, dep := range deps {
+		dep = l.localDep(c, ix, dep, from)
+		if !seen[dep] {
+			seen[dep] = true
+			local = append(local, dep)
+		}
+	}
+	r.SetAttr("deps", local)
+}
+
+// localDep returns the local label for dep if it is in the external repo of
+// an in-repo module, and dep otherwise.
+func (l *InRepoModules) localDep(c *config.Config, ix *resolve.RuleIndex, dep string, from label.Label) string {
+	dl, err := label.Parse(dep)
+	if err != nil || dl.Repo == "" {
+		return dep
+	}
+	m, ok := l.byRepo[dl.Repo]
+	if !ok {
+		return dep
+	}
+
+	// the package at the same import path in the repo; gazelle names
+	// go_deps packages the same way it names local ones, so without an
+	// indexed library the label is derived from the directory
+	imp := path.Join(m.path, dl.Pkg)
+	target := label.New("", path.Join(m.rel, dl.Pkg), dl.Name)
+	if found := ix.FindRulesByImportWithConfig(c, resolve.ImportSpec{Lang: "go", Imp: imp}, "go"); len(found) > 0 {
+		target = found[0].Label
+	}
+	target = target.Rel(from.Repo, from.Pkg)
+
+	log.Printf("%s: %s is the external copy of in-repo module %s, depending on %s instead", from, dep, m.path, target)
+	return target.String()
+}
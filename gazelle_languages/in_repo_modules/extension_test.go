@@ -0,0 +1,124 @@
+package in_repo_modules
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/bazelbuild/bazel-gazelle/testtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindModules(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "go.work", Content: "go 1.23\n"},
+		{Path: "mod_a/go.mod", Content: "module github.com/example/repo/mod_a\n"},
+		{Path: "libs/mod_b/go.mod", Content: "module github.com/example/repo/mod_b\n"},
+		{Path: "libs/mod_b/testdata/go.mod", Content: "module github.com/example/repo/mod_b/testdata\n"},
+		{Path: "broken/go.mod", Content: "go 1.23\n"},
+		{Path: ".git/go.mod", Content: "module hidden\n"},
+		{Path: "bazel-out/go.mod", Content: "module output\n"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	modules, err := findModules(dir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []inRepoModule{
+		{path: "github.com/example/repo/mod_a", rel: "mod_a"},
+		{path: "github.com/example/repo/mod_b", rel: "libs/mod_b"},
+		{path: "github.com/example/repo/mod_b/testdata", rel: "libs/mod_b/testdata"},
+	}, modules)
+}
+
+func TestGoDepsRepoName(t *testing.T) {
+	tests := []struct {
+		importpath string
+		want       string
+	}{
+		{"github.com/stretchr/testify", "com_github_stretchr_testify"},
+		{"github.com/stefanpenner/-bazel-go-mod-experiment/mod_b", "com_github_stefanpenner__bazel_go_mod_experiment_mod_b"},
+		{"gopkg.in/yaml.v3", "in_gopkg_yaml_v3"},
+		{"example.com/Mixed.Case/v2", "com_example_mixed_case_v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.importpath, func(t *testing.T) {
+			assert.Equal(t, tt.want, goDepsRepoName(tt.importpath))
+		})
+	}
+}
+
+func TestInRepoModules_Resolve(t *testing.T) {
+	files := []testtools.FileSpec{
+		{Path: "mod_a/go.mod", Content: "module github.com/example/-repo/mod_a\n"},
+		{Path: "libs/mod_b/go.mod", Content: "module github.com/example/-repo/mod_b\n"},
+	}
+	dir, cleanup := testtools.CreateFiles(t, files)
+	defer cleanup()
+
+	c := config.New()
+	c.RepoRoot = dir
+	ext := NewLanguage().(*InRepoModules)
+	ext.Configure(c, "", &rule.File{})
+
+	// mod_b/sub is indexed under a name gazelle wouldn't derive
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return ext })
+	sub := rule.NewRule("go_library", "custom")
+	sub.SetAttr("importpath", "github.com/example/-repo/mod_b/sub")
+	ix.AddRule(c, sub, &rule.File{Pkg: "libs/mod_b/sub"})
+	ix.Finish()
+
+	tests := []struct {
+		name string
+		deps []string
+		want []string
+	}{
+		{
+			name: "external copies of in-repo modules become local labels",
+			deps: []string{
+				"@com_github_example__repo_mod_b//:mod_b",
+				"@com_github_example__repo_mod_b//sub",
+				"@com_github_stretchr_testify//assert",
+			},
+			want: []string{
+				"//libs/mod_b",
+				"//libs/mod_b/sub:custom",
+				"@com_github_stretchr_testify//assert",
+			},
+		},
+		{
+			name: "repos named the WORKSPACE way are recognized too",
+			deps: []string{"@com_github_example_repo_mod_b//:mod_b"},
+			want: []string{"//libs/mod_b"},
+		},
+		{
+			name: "depending on both copies leaves one",
+			deps: []string{"//libs/mod_b", "@com_github_example__repo_mod_b//:mod_b"},
+			want: []string{"//libs/mod_b"},
+		},
+		{
+			name: "labels in other packages of the module are absolute",
+			deps: []string{"@com_github_example__repo_mod_a//internal"},
+			want: []string{"//mod_a/internal"},
+		},
+		{
+			name: "labels in the same package are relative",
+			deps: []string{"@com_github_example__repo_mod_a//:helpers"},
+			want: []string{":helpers"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := rule.NewRule("go_library", "mod_a_lib")
+			// without imports the go extension leaves deps alone, so these
+			// stand in for the ones it resolved
+			r.SetAttr("deps", tt.deps)
+			ext.Resolve(c, ix, nil, r, nil, label.New("", "mod_a", "mod_a_lib"))
+			assert.Equal(t, tt.want, r.AttrStrings("deps"))
+		})
+	}
+}
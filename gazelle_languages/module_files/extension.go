@@ -2,6 +2,7 @@ package module_files
 
 import (
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
@@ -18,11 +19,14 @@ import (
 type ModuleFiles struct {
 	language.BaseLang  // see: https://github.com/bazel-contrib/bazel-gazelle/blob/master/language/base.go
 	visitedModuleFiles *OrderedSet[string]
+	// packages with a go.mod, whose files belong to their own module
+	moduleRoots *OrderedSet[string]
 }
 
 func NewLanguage() language.Language {
 	return &ModuleFiles{
 		visitedModuleFiles: NewOrderedSet[string](),
+		moduleRoots:        NewOrderedSet[string](),
 	}
 }
 
@@ -48,6 +52,18 @@ var (
 	_ language.Language = &ModuleFiles{}
 )
 
+// Imports indexes every _pkg_ filegroup by its package, so other extensions
+// (go_mod) can find out which packages module_files actually generated a
+// filegroup for, rather than guessing from the directory tree:
+//
+//	ix.FindRulesByImportWithConfig(c, resolve.ImportSpec{Lang: "module_files", Imp: pkg}, "module_files")
+func (mf *ModuleFiles) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+	if r.Kind() != "filegroup" || r.Name() != TARGET_NAME {
+		return nil
+	}
+	return []resolve.ImportSpec{{Lang: mf.Name(), Imp: f.Pkg}}
+}
+
 func (mf *ModuleFiles) KnownDirectives() []string {
 	return []string{"module_files_exclude"}
 }
@@ -105,6 +121,10 @@ func (mf *ModuleFiles) GenerateRules(args language.GenerateArgs) language.Genera
 
 	srcs := NewOrderedSetFromSlice(files)
 
+	if slices.Contains(args.RegularFiles, "go.mod") {
+		mf.moduleRoots.Add(args.Rel)
+	}
+
 	if srcs.Len() > 0 {
 		r := rule.NewRule("filegroup", TARGET_NAME)
 
@@ -121,10 +141,15 @@ func (mf *ModuleFiles) GenerateRules(args language.GenerateArgs) language.Genera
 
 		mf.visitedModuleFiles.Range(func(rel string) {
 			if strings.HasPrefix(rel, args.Rel) {
-				// construct the label
-				srcs.Add("//" + rel + ":" + TARGET_NAME)
 				// Ok we used it, so we can delete it
 				mf.visitedModuleFiles.Remove(rel)
+				if mf.moduleRoots.Contains(rel) {
+					// a nested module ships its own files, its go_mod
+					// includes them, so they must not end up in ours too
+					return
+				}
+				// construct the label
+				srcs.Add("//" + rel + ":" + TARGET_NAME)
 			}
 		})
 
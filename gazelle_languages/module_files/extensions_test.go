@@ -6,6 +6,7 @@ import (
 
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 	"github.com/bazelbuild/bazel-gazelle/testtools"
 	"github.com/bazelbuild/bazel-gazelle/walk"
@@ -208,3 +209,49 @@ func TestModuleFiles_EnsureCustomFileExcludeDirectivesWork(t *testing.T) {
 	srcs := r.AttrStrings("srcs")
 	assert.ElementsMatch(t, []string{"BUILD.bazel", "foo.go"}, srcs)
 }
+
+func TestModuleFiles_Imports(t *testing.T) {
+	ext := NewLanguage().(*ModuleFiles)
+	cfg := &config.Config{}
+	f := &rule.File{Pkg: "foo/bar"}
+
+	t.Run("_pkg_ filegroups are indexed by package", func(t *testing.T) {
+		r := rule.NewRule("filegroup", TARGET_NAME)
+		want := []resolve.ImportSpec{{Lang: "module_files", Imp: "foo/bar"}}
+		assert.Equal(t, want, ext.Imports(cfg, r, f))
+	})
+
+	t.Run("other filegroups are not indexed", func(t *testing.T) {
+		r := rule.NewRule("filegroup", "testdata")
+		assert.Empty(t, ext.Imports(cfg, r, f))
+	})
+}
+
+func TestModuleFiles_GenerateRules_NestedModule(t *testing.T) {
+	ext := NewLanguage().(*ModuleFiles)
+	cfg := &config.Config{}
+
+	// foo/
+	//   go.mod
+	//   a/a.go
+	//   b/b.go
+	//   c/c.go
+	//   nested/
+	//     go.mod
+	//     sub/sub.go
+	generate := func(rel string, files ...string) []string {
+		res := ext.GenerateRules(language.GenerateArgs{Config: cfg, Rel: rel, RegularFiles: files})
+		require.Len(t, res.Gen, 1)
+		return res.Gen[0].AttrStrings("srcs")
+	}
+
+	generate("foo/a", "a.go")
+	generate("foo/b", "b.go")
+	generate("foo/c", "c.go")
+	generate("foo/nested/sub", "sub.go")
+	assert.Equal(t, []string{"go.mod", "//foo/nested/sub:_pkg_"}, generate("foo/nested", "go.mod"))
+
+	// the nested module's files are its own, not foo's
+	assert.Equal(t, []string{"go.mod", "//foo/a:_pkg_", "//foo/b:_pkg_", "//foo/c:_pkg_"}, generate("foo", "go.mod"))
+	assert.Equal(t, []string{"foo"}, ext.visitedModuleFiles.ToSlice())
+}
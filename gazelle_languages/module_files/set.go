@@ -54,8 +54,9 @@ func (s *OrderedSet[T]) ToSlice() []T {
 	return append([]T(nil), s.order...)
 }
 
+// Range calls f for every entry, in insertion order. f may remove entries.
 func (s *OrderedSet[T]) Range(f func(T)) {
-	for _, entry := range s.order {
+	for _, entry := range s.ToSlice() {
 		f(entry)
 	}
 }
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+type CheckAPIConfig struct {
+	Zip      string
+	ProxyDir string
+	Previous string
+	Version  string
+}
+
+// moduleAPI maps each importable package of a module to its exported
+// objects. Every object is rendered to a string that changes whenever the
+// object changes in a way that matters to importers.
+type moduleAPI map[string]map[string]string
+
+// apiChange is a single difference between two versions of a module's API.
+type apiChange struct {
+	Package    string
+	Object     string
+	Message    string
+	Compatible bool
+}
+
+func (c apiChange) String() string {
+	if c.Object == "" {
+		return c.Package + ": " + c.Message
+	}
+	return fmt.Sprintf("%s.%s: %s", c.Package, c.Object, c.Message)
+}
+
+// apiReport classifies the changes between two versions of an API in the
+// style of golang.org/x/exp/apidiff: additions are compatible, removals and
+// changes are not.
+type apiReport struct {
+	Changes []apiChange
+}
+
+func (r apiReport) incompatible() []apiChange {
+	var changes []apiChange
+	for _, c := range r.Changes {
+		if !c.Compatible {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// requiredBump returns the smallest semver bump that covers the changes from
+// a module at version prev: incompatible changes need a new major version
+// (a minor one before v1), additions a new minor version. Without changes any
+// new version will do.
+func (r apiReport) requiredBump(prev string) bumpKind {
+	if len(r.incompatible()) > 0 {
+		if semver.Major(prev) == "v0" {
+			return bumpMinor
+		}
+		return bumpMajor
+	}
+	if len(r.Changes) > 0 {
+		return bumpMinor
+	}
+	return bumpNone
+}
+
+// versionBumpKind returns the kind of bump that leads from prev to next.
+// Moving from a prerelease to its release counts as no bump.
+func versionBumpKind(prev, next string) bumpKind {
+	switch {
+	case semver.Major(prev) != semver.Major(next):
+		return bumpMajor
+	case semver.MajorMinor(prev) != semver.MajorMinor(next):
+		return bumpMinor
+	case semver.Canonical(prev) != semver.Canonical(next) && semver.Prerelease(prev) == "":
+		return bumpPatch
+	}
+	return bumpNone
+}
+
+// diffAPI compares the API of two versions of the same module.
+func diffAPI(oldAPI, newAPI moduleAPI) apiReport {
+	var r apiReport
+	for _, pkg := range sortedKeys(oldAPI) {
+		newObjs, ok := newAPI[pkg]
+		if !ok {
+			r.Changes = append(r.Changes, apiChange{Package: pkg, Message: "package removed"})
+			continue
+		}
+		for _, name := range sortedKeys(oldAPI[pkg]) {
+			oldObj := oldAPI[pkg][name]
+			newObj, ok := newObjs[name]
+			switch {
+			case !ok:
+				r.Changes = append(r.Changes, apiChange{Package: pkg, Object: name, Message: "removed"})
+			case newObj != oldObj:
+				r.Changes = append(r.Changes, apiChange{Package: pkg, Object: name, Message: fmt.Sprintf("changed from %s to %s", oldObj, newObj)})
+			}
+		}
+	}
+	for _, pkg := range sortedKeys(newAPI) {
+		oldObjs, ok := oldAPI[pkg]
+		if !ok {
+			r.Changes = append(r.Changes, apiChange{Package: pkg, Message: "package added", Compatible: true})
+			continue
+		}
+		for _, name := range sortedKeys(newAPI[pkg]) {
+			if _, ok := oldObjs[name]; !ok {
+				r.Changes = append(r.Changes, apiChange{Package: pkg, Object: name, Message: "added", Compatible: true})
+			}
+		}
+	}
+	return r
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readArchiveAPI extracts the exported API of the module in a module .zip.
+func readArchiveAPI(zipPath string) (moduleAPI, string, string, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer zr.Close()
+
+	modulePath, version, err := archiveModuleVersion(&zr.Reader)
+	if err != nil {
+		return nil, "", "", err
+	}
+	root, err := fs.Sub(&zr.Reader, modulePath+"@"+version)
+	if err != nil {
+		return nil, "", "", err
+	}
+	api, err := extractAPI(root, modulePath)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("%s: %w", zipPath, err)
+	}
+	return api, modulePath, version, nil
+}
+
+// extractAPI parses the Go files of the module rooted at fsys and returns its
+// exported API. Tests, testdata, internal and main packages, and nested
+// modules are not part of what importers can see, so they are skipped.
+func extractAPI(fsys fs.FS, modulePath string) (moduleAPI, error) {
+	fset := token.NewFileSet()
+	api := moduleAPI{}
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p == "." {
+				return nil
+			}
+			name := d.Name()
+			if name == "testdata" || name == "internal" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return fs.SkipDir
+			}
+			if _, err := fs.Stat(fsys, path.Join(p, "go.mod")); err == nil {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(p, ".go") || strings.HasSuffix(p, "_test.go") {
+			return nil
+		}
+
+		src, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		file, err := parser.ParseFile(fset, p, src, parser.SkipObjectResolution)
+		if err != nil {
+			return err
+		}
+		if file.Name.Name == "main" {
+			return nil
+		}
+
+		importPath := modulePath
+		if dir := path.Dir(p); dir != "." {
+			importPath += "/" + dir
+		}
+		objs, ok := api[importPath]
+		if !ok {
+			objs = map[string]string{}
+			api[importPath] = objs
+		}
+		addFileAPI(objs, file)
+		return nil
+	})
+	return api, err
+}
+
+// addFileAPI records the exported declarations of a single file.
+func addFileAPI(objs map[string]string, file *ast.File) {
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() {
+				continue
+			}
+			if decl.Recv == nil {
+				objs[decl.Name.Name] = "func" + typeParamsString(decl.Type.TypeParams) + signatureString(decl.Type)
+				continue
+			}
+			recv, pointer := receiverType(decl.Recv.List[0].Type)
+			if !ast.IsExported(recv) {
+				continue
+			}
+			if pointer {
+				objs[recv+"."+decl.Name.Name] = "method (*" + recv + ") " + signatureString(decl.Type)
+			} else {
+				objs[recv+"."+decl.Name.Name] = "method (" + recv + ") " + signatureString(decl.Type)
+			}
+		case *ast.GenDecl:
+			addGenDeclAPI(objs, decl)
+		}
+	}
+}
+
+func addGenDeclAPI(objs map[string]string, decl *ast.GenDecl) {
+	// constants in a group without a type or value repeat the previous spec
+	var lastConstType string
+	for _, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			if !spec.Name.IsExported() {
+				continue
+			}
+			name := spec.Name.Name
+			tparams := typeParamsString(spec.TypeParams)
+			if spec.Assign.IsValid() {
+				objs[name] = "type = " + types.ExprString(spec.Type)
+				continue
+			}
+			switch t := spec.Type.(type) {
+			case *ast.StructType:
+				objs[name] = "type" + tparams + " struct"
+				for _, field := range t.Fields.List {
+					for _, fieldName := range fieldNames(field) {
+						if ast.IsExported(fieldName) {
+							objs[name+"."+fieldName] = "field " + types.ExprString(field.Type)
+						}
+					}
+				}
+			case *ast.InterfaceType:
+				// adding a method to an interface breaks its implementations
+				// and removing one breaks its callers, so any change counts
+				objs[name] = "type" + tparams + " " + interfaceString(t)
+			default:
+				objs[name] = "type" + tparams + " " + types.ExprString(spec.Type)
+			}
+		case *ast.ValueSpec:
+			kind := "var"
+			if decl.Tok == token.CONST {
+				kind = "const"
+			}
+			typ := "untyped"
+			if spec.Type != nil {
+				typ = types.ExprString(spec.Type)
+			} else if decl.Tok == token.CONST && len(spec.Values) == 0 && lastConstType != "" {
+				typ = lastConstType
+			}
+			if decl.Tok == token.CONST && (spec.Type != nil || len(spec.Values) > 0) {
+				lastConstType = typ
+			}
+			for _, n := range spec.Names {
+				if n.IsExported() {
+					objs[n.Name] = kind + " " + typ
+				}
+			}
+		}
+	}
+}
+
+// fieldNames returns the names a struct field is reachable by: its declared
+// names, or the type name for an embedded field.
+func fieldNames(field *ast.Field) []string {
+	if len(field.Names) > 0 {
+		names := make([]string, len(field.Names))
+		for i, n := range field.Names {
+			names[i] = n.Name
+		}
+		return names
+	}
+	name, _ := receiverType(field.Type)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return []string{name}
+}
+
+// receiverType returns the base type name of a method receiver or embedded
+// field, and whether it is a pointer.
+func receiverType(expr ast.Expr) (string, bool) {
+	pointer := false
+	if star, ok := expr.(*ast.StarExpr); ok {
+		pointer = true
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.IndexExpr:
+		expr = t.X
+	case *ast.IndexListExpr:
+		expr = t.X
+	}
+	return types.ExprString(expr), pointer
+}
+
+// signatureString renders a function type without parameter names, which
+// callers don't depend on.
+func signatureString(fn *ast.FuncType) string {
+	s := "(" + fieldTypes(fn.Params) + ")"
+	if fn.Results == nil || len(fn.Results.List) == 0 {
+		return s
+	}
+	results := fieldTypes(fn.Results)
+	if len(fn.Results.List) == 1 && len(fn.Results.List[0].Names) <= 1 {
+		return s + " " + results
+	}
+	return s + " (" + results + ")"
+}
+
+func fieldTypes(fields *ast.FieldList) string {
+	if fields == nil {
+		return ""
+	}
+	var parts []string
+	for _, f := range fields.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			parts = append(parts, types.ExprString(f.Type))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func typeParamsString(fields *ast.FieldList) string {
+	if fields == nil || len(fields.List) == 0 {
+		return ""
+	}
+	var parts []string
+	for _, f := range fields.List {
+		for range f.Names {
+			parts = append(parts, types.ExprString(f.Type))
+		}
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// interfaceString renders an interface with its methods and embedded types
+// sorted, so reordering them is not reported as a change.
+func interfaceString(t *ast.InterfaceType) string {
+	var elems []string
+	for _, m := range t.Methods.List {
+		if fn, ok := m.Type.(*ast.FuncType); ok {
+			for _, n := range m.Names {
+				elems = append(elems, n.Name+signatureString(fn))
+			}
+			continue
+		}
+		elems = append(elems, types.ExprString(m.Type))
+	}
+	sort.Strings(elems)
+	return "interface{" + strings.Join(elems, "; ") + "}"
+}
+
+// runCheckAPI compares the archive in cfg.Zip with the previous version
+// published to cfg.ProxyDir, prints the changes and fails when the version
+// bump is smaller than the changes require.
+func runCheckAPI(cfg CheckAPIConfig, out io.Writer) error {
+	newAPI, modulePath, version, err := readArchiveAPI(cfg.Zip)
+	if err != nil {
+		return err
+	}
+	if cfg.Version != "" {
+		version = cfg.Version
+	}
+	if !semver.IsValid(version) {
+		return fmt.Errorf("%s: version %q is not a valid semantic version", cfg.Zip, version)
+	}
+
+	prev := cfg.Previous
+	if prev == "" {
+		versions, err := proxyVersions(cfg.ProxyDir, modulePath)
+		if err != nil {
+			return err
+		}
+		prev = latestVersionBefore(versions, version)
+	}
+	if prev == "" {
+		fmt.Fprintf(out, "%s@%s: no previous version in %s, nothing to compare\n", modulePath, version, cfg.ProxyDir)
+		return nil
+	}
+
+	prevZip, err := proxyFile(cfg.ProxyDir, modulePath, prev, ".zip")
+	if err != nil {
+		return err
+	}
+	oldAPI, _, _, err := readArchiveAPI(prevZip)
+	if err != nil {
+		return err
+	}
+
+	report := diffAPI(oldAPI, newAPI)
+	fmt.Fprintf(out, "%s: %s -> %s\n", modulePath, prev, version)
+	for _, c := range report.Changes {
+		label := "compatible"
+		if !c.Compatible {
+			label = "incompatible"
+		}
+		fmt.Fprintf(out, "  %s: %s\n", label, c)
+	}
+
+	required := report.requiredBump(prev)
+	if actual := versionBumpKind(prev, version); actual < required {
+		return fmt.Errorf("%s@%s: %s bump from %s is too small, the API changes require a %s bump", modulePath, version, actual, prev, required)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractAPI(t *testing.T) {
+	fsys := fstest.MapFS{
+		"go.mod": {Data: []byte("module example.com/lib\n")},
+		"lib.go": {Data: []byte(`package lib
+
+import "io"
+
+const (
+	A Kind = iota
+	B
+	c
+)
+
+const Untyped = 1
+
+var Default = New()
+
+type Kind int
+
+type Alias = Kind
+
+type Options struct {
+	Name    string
+	io.Reader
+	private int
+}
+
+type Store[K comparable, V any] interface {
+	Put(key K, value V) error
+	Get(K) (V, bool)
+}
+
+func New(names ...string) *Options { return nil }
+
+func (o *Options) Open(path string, flags int) (io.ReadCloser, error) { return nil, nil }
+
+func (k Kind) String() string { return "" }
+
+func (o *Options) unexported() {}
+
+func helper() {}
+`)},
+		"lib_test.go":               {Data: []byte("package lib\n\nfunc TestOnly() {}\n")},
+		"sub/sub.go":                {Data: []byte("package sub\n\nfunc Sub(a, b int) (x, y int) { return }\n")},
+		"internal/in/in.go":         {Data: []byte("package in\n\nfunc Hidden() {}\n")},
+		"testdata/data.go":          {Data: []byte("package data\n\nfunc Data() {}\n")},
+		"cmd/tool/main.go":          {Data: []byte("package main\n\nfunc Main() {}\n")},
+		"nested/go.mod":             {Data: []byte("module example.com/lib/nested\n")},
+		"nested/nested.go":          {Data: []byte("package nested\n\nfunc Nested() {}\n")},
+		"sub/unexported/private.go": {Data: []byte("package unexported\n\nfunc private() {}\n")},
+	}
+
+	api, err := extractAPI(fsys, "example.com/lib")
+	require.NoError(t, err)
+
+	assert.Equal(t, moduleAPI{
+		"example.com/lib": {
+			"A":              "const Kind",
+			"B":              "const Kind",
+			"Untyped":        "const untyped",
+			"Default":        "var untyped",
+			"Kind":           "type int",
+			"Alias":          "type = Kind",
+			"Options":        "type struct",
+			"Options.Name":   "field string",
+			"Options.Reader": "field io.Reader",
+			"Store":          "type[comparable, any] interface{Get(K) (V, bool); Put(K, V) error}",
+			"New":            "func(...string) *Options",
+			"Options.Open":   "method (*Options) (string, int) (io.ReadCloser, error)",
+			"Kind.String":    "method (Kind) () string",
+		},
+		"example.com/lib/sub": {
+			"Sub": "func(int, int) (int, int)",
+		},
+		"example.com/lib/sub/unexported": {},
+	}, api)
+}
+
+func TestDiffAPI(t *testing.T) {
+	oldAPI := moduleAPI{
+		"example.com/lib": {
+			"New":  "func() *Options",
+			"Open": "func(string) error",
+			"Kind": "type int",
+		},
+		"example.com/lib/old": {
+			"Old": "func()",
+		},
+	}
+	newAPI := moduleAPI{
+		"example.com/lib": {
+			"New":  "func(...string) *Options",
+			"Kind": "type int",
+			"Keep": "func()",
+		},
+		"example.com/lib/fresh": {},
+	}
+
+	report := diffAPI(oldAPI, newAPI)
+	var got []string
+	for _, c := range report.Changes {
+		got = append(got, c.String())
+	}
+	assert.Equal(t, []string{
+		"example.com/lib.New: changed from func() *Options to func(...string) *Options",
+		"example.com/lib.Open: removed",
+		"example.com/lib/old: package removed",
+		"example.com/lib.Keep: added",
+		"example.com/lib/fresh: package added",
+	}, got)
+	assert.Len(t, report.incompatible(), 3)
+	assert.Equal(t, bumpMajor, report.requiredBump("v1.2.3"))
+	assert.Equal(t, bumpMinor, report.requiredBump("v0.2.3"))
+
+	additions := diffAPI(moduleAPI{"example.com/lib": {}}, moduleAPI{"example.com/lib": {"New": "func()"}})
+	assert.Equal(t, bumpMinor, additions.requiredBump("v1.2.3"))
+	assert.Equal(t, bumpNone, diffAPI(oldAPI, oldAPI).requiredBump("v1.2.3"))
+}
+
+func TestVersionBumpKind(t *testing.T) {
+	tests := []struct {
+		prev, next string
+		want       bumpKind
+	}{
+		{"v1.2.3", "v1.2.4", bumpPatch},
+		{"v1.2.3", "v1.3.0", bumpMinor},
+		{"v1.2.3", "v2.0.0", bumpMajor},
+		{"v1.2.3", "v1.2.3", bumpNone},
+		{"v1.2.0-rc.1", "v1.2.0", bumpNone},
+		{"v1.2.3", "v1.2.4-rc.1", bumpPatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prev+" "+tt.next, func(t *testing.T) {
+			assert.Equal(t, tt.want, versionBumpKind(tt.prev, tt.next))
+		})
+	}
+}
+
+func TestRunCheckAPI(t *testing.T) {
+	proxyDir := t.TempDir()
+	vdir := filepath.Join(proxyDir, "example.com", "lib", "@v")
+	require.NoError(t, os.MkdirAll(vdir, 0755))
+	writeTestZip(t, filepath.Join(vdir, "v1.0.0.zip"), map[string]string{
+		"example.com/lib@v1.0.0/go.mod": "module example.com/lib\n",
+		"example.com/lib@v1.0.0/lib.go": "package lib\n\nfunc Open() {}\n\nfunc Close() {}\n",
+	})
+
+	tests := []struct {
+		name    string
+		version string
+		lib     string
+		wantErr string
+	}{
+		{"unchanged patch", "v1.0.1", "package lib\n\nfunc Open() {}\n\nfunc Close() {}\n", ""},
+		{"addition patch", "v1.0.1", "package lib\n\nfunc Open() {}\n\nfunc Close() {}\n\nfunc Flush() {}\n", "patch bump from v1.0.0 is too small, the API changes require a minor bump"},
+		{"addition minor", "v1.1.0", "package lib\n\nfunc Open() {}\n\nfunc Close() {}\n\nfunc Flush() {}\n", ""},
+		{"removal minor", "v1.1.0", "package lib\n\nfunc Open() {}\n", "minor bump from v1.0.0 is too small, the API changes require a major bump"},
+		{"removal major", "v2.0.0", "package lib\n\nfunc Open() {}\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zipPath := filepath.Join(t.TempDir(), "lib.zip")
+			writeTestZip(t, zipPath, map[string]string{
+				"example.com/lib@" + tt.version + "/go.mod": "module example.com/lib\n",
+				"example.com/lib@" + tt.version + "/lib.go": tt.lib,
+			})
+
+			out := new(bytes.Buffer)
+			err := runCheckAPI(CheckAPIConfig{Zip: zipPath, ProxyDir: proxyDir}, out)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Contains(t, out.String(), "example.com/lib: v1.0.0 -> "+tt.version)
+		})
+	}
+
+	t.Run("first release", func(t *testing.T) {
+		zipPath := filepath.Join(t.TempDir(), "new.zip")
+		writeTestZip(t, zipPath, map[string]string{
+			"example.com/new@v0.1.0/go.mod": "module example.com/new\n",
+		})
+		out := new(bytes.Buffer)
+		require.NoError(t, runCheckAPI(CheckAPIConfig{Zip: zipPath, ProxyDir: proxyDir}, out))
+		assert.Contains(t, out.String(), "no previous version")
+	})
+}
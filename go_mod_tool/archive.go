@@ -0,0 +1,109 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// archiveFile is a single file of a module archive, relative to the module root.
+type archiveFile struct {
+	Path   string
+	SHA1   string
+	SHA256 string
+}
+
+// moduleArchive is what a built module .zip contains.
+type moduleArchive struct {
+	ModulePath string
+	Version    string
+	GoMod      []byte
+	Files      []archiveFile
+}
+
+// readModuleArchive reads the module path, version, go.mod and file digests
+// from a module .zip.
+func readModuleArchive(zipPath string) (*moduleArchive, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	a := &moduleArchive{}
+	a.ModulePath, a.Version, err = archiveModuleVersion(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+	prefix := a.ModulePath + "@" + a.Version + "/"
+
+	a.GoMod, err = readZipFile(&zr.Reader, prefix+"go.mod")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		h1 := sha1.New()
+		h256 := sha256.New()
+		_, err = io.Copy(io.MultiWriter(h1, h256), rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+		a.Files = append(a.Files, archiveFile{
+			Path:   strings.TrimPrefix(f.Name, prefix),
+			SHA1:   hex.EncodeToString(h1.Sum(nil)),
+			SHA256: hex.EncodeToString(h256.Sum(nil)),
+		})
+	}
+	return a, nil
+}
+
+// archiveModuleVersion returns the module path and version from the
+// "module@version/" prefix shared by every entry of the archive.
+func archiveModuleVersion(zr *zip.Reader) (string, string, error) {
+	if len(zr.File) == 0 {
+		return "", "", fmt.Errorf("archive is empty")
+	}
+	// module paths may contain slashes but never "@", and versions never contain slashes
+	modulePath, rest, ok := strings.Cut(zr.File[0].Name, "@")
+	version, _, hasSlash := strings.Cut(rest, "/")
+	if !ok || !hasSlash || version == "" {
+		return "", "", fmt.Errorf("archive entry %q is not inside a module@version directory", zr.File[0].Name)
+	}
+	prefix := modulePath + "@" + version + "/"
+	for _, f := range zr.File {
+		if !strings.HasPrefix(f.Name, prefix) {
+			return "", "", fmt.Errorf("archive entry %q is not inside %s", f.Name, prefix)
+		}
+	}
+	return modulePath, version, nil
+}
+
+// readZipFile returns the content of the first entry named name.
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if path.Clean(f.Name) != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("%s not found in archive", name)
+}
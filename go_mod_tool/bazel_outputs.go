@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// goModRuleClass is the rule class of go_mod targets, as bazel query reports it.
+const goModRuleClass = "_go_mod"
+
+type ArchivesConfig struct {
+	Query  string
+	BEP    string
+	Output string
+}
+
+// moduleArchiveTarget ties a go_mod target to the module it archives and the
+// .zip the build produced for it.
+type moduleArchiveTarget struct {
+	Label      string `json:"label"`
+	ModulePath string `json:"module_path"`
+	GoMod      string `json:"go_mod"`
+	Zip        string `json:"zip"`
+}
+
+// archivesFile is the output of `go_mod_tool archives`, and what `plan`
+// reads with --archives.
+type archivesFile struct {
+	Archives []moduleArchiveTarget `json:"archives"`
+}
+
+// The types below are the parts of bazel's query and build event protocol
+// messages, in their proto3 JSON form, that go_mod_tool reads.
+// See: src/main/protobuf/build.proto and build_event_stream.proto
+
+type queryTarget struct {
+	Type string     `json:"type"`
+	Rule *queryRule `json:"rule"`
+}
+
+type queryRule struct {
+	Name      string           `json:"name"`
+	RuleClass string           `json:"ruleClass"`
+	Attribute []queryAttribute `json:"attribute"`
+}
+
+type queryAttribute struct {
+	Name        string `json:"name"`
+	StringValue string `json:"stringValue"`
+}
+
+type buildEvent struct {
+	ID struct {
+		NamedSet *struct {
+			ID string `json:"id"`
+		} `json:"namedSet"`
+		TargetCompleted *struct {
+			Label string `json:"label"`
+		} `json:"targetCompleted"`
+	} `json:"id"`
+	NamedSetOfFiles *struct {
+		Files    []bepFile `json:"files"`
+		FileSets []bepRef  `json:"fileSets"`
+	} `json:"namedSetOfFiles"`
+	Completed *struct {
+		Success     bool `json:"success"`
+		OutputGroup []struct {
+			Name     string   `json:"name"`
+			FileSets []bepRef `json:"fileSets"`
+		} `json:"outputGroup"`
+	} `json:"completed"`
+}
+
+type bepRef struct {
+	ID string `json:"id"`
+}
+
+type bepFile struct {
+	Name       string   `json:"name"`
+	URI        string   `json:"uri"`
+	PathPrefix []string `json:"pathPrefix"`
+}
+
+// path returns where the file is: the local path of a file:// URI, or the
+// path relative to the execution root bazel reports otherwise.
+func (f bepFile) path() string {
+	if u, err := url.Parse(f.URI); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+	return path.Join(append(append([]string{}, f.PathPrefix...), f.Name)...)
+}
+
+// normalizeLabel strips the repository part of a main repository label, which
+// bazel prints as "//pkg:name" or "@@//pkg:name" depending on the flags used.
+func normalizeLabel(label string) string {
+	if strings.HasPrefix(label, "@//") || strings.HasPrefix(label, "@@//") {
+		return strings.TrimLeft(label, "@")
+	}
+	return label
+}
+
+// decodeJSONStream calls fn with every JSON value of a newline delimited
+// stream, as written by --output=streamed_jsonproto and --build_event_json_file.
+func decodeJSONStream(path string, fn func(dec *json.Decoder) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		if err := fn(dec); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+}
+
+// readGoModTargets returns the go_mod rules of a streamed_jsonproto query result.
+func readGoModTargets(path string) ([]moduleArchiveTarget, error) {
+	var targets []moduleArchiveTarget
+	err := decodeJSONStream(path, func(dec *json.Decoder) error {
+		var t queryTarget
+		if err := dec.Decode(&t); err != nil {
+			return err
+		}
+		if t.Type != "RULE" || t.Rule == nil || t.Rule.RuleClass != goModRuleClass {
+			return nil
+		}
+
+		target := moduleArchiveTarget{Label: normalizeLabel(t.Rule.Name)}
+		for _, attr := range t.Rule.Attribute {
+			switch attr.Name {
+			case "module_path":
+				target.ModulePath = attr.StringValue
+			case "go_mod":
+				target.GoMod = normalizeLabel(attr.StringValue)
+			}
+		}
+		if target.ModulePath == "" {
+			return fmt.Errorf("%s has no module_path", target.Label)
+		}
+		targets = append(targets, target)
+		return nil
+	})
+	return targets, err
+}
+
+// readBuiltZips returns the .zip in the default outputs of every target the
+// build event stream reports as built, by label.
+func readBuiltZips(path string) (map[string]string, error) {
+	type namedSet struct {
+		files []bepFile
+		sets  []bepRef
+	}
+	sets := map[string]namedSet{}
+	defaults := map[string][]bepRef{}
+	var failed []string
+
+	err := decodeJSONStream(path, func(dec *json.Decoder) error {
+		var ev buildEvent
+		if err := dec.Decode(&ev); err != nil {
+			return err
+		}
+		switch {
+		case ev.ID.NamedSet != nil && ev.NamedSetOfFiles != nil:
+			sets[ev.ID.NamedSet.ID] = namedSet{files: ev.NamedSetOfFiles.Files, sets: ev.NamedSetOfFiles.FileSets}
+		case ev.ID.TargetCompleted != nil && ev.Completed != nil:
+			label := normalizeLabel(ev.ID.TargetCompleted.Label)
+			if !ev.Completed.Success {
+				failed = append(failed, label)
+				return nil
+			}
+			for _, group := range ev.Completed.OutputGroup {
+				if group.Name == "default" {
+					defaults[label] = group.FileSets
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("%s: targets failed to build: %s", path, strings.Join(failed, ", "))
+	}
+
+	// named sets reference each other, and may be announced after their users
+	var collect func(ref bepRef, seen map[string]bool) []bepFile
+	collect = func(ref bepRef, seen map[string]bool) []bepFile {
+		if seen[ref.ID] {
+			return nil
+		}
+		seen[ref.ID] = true
+		set := sets[ref.ID]
+		files := append([]bepFile{}, set.files...)
+		for _, child := range set.sets {
+			files = append(files, collect(child, seen)...)
+		}
+		return files
+	}
+
+	zips := map[string]string{}
+	for label, refs := range defaults {
+		seen := map[string]bool{}
+		for _, ref := range refs {
+			for _, f := range collect(ref, seen) {
+				if strings.HasSuffix(f.Name, ".zip") {
+					zips[label] = f.path()
+				}
+			}
+		}
+	}
+	return zips, nil
+}
+
+// locateArchives joins go_mod targets with the zips the build produced.
+// Targets that were not built are left out.
+func locateArchives(targets []moduleArchiveTarget, zips map[string]string) []moduleArchiveTarget {
+	var located []moduleArchiveTarget
+	for _, t := range targets {
+		if zip, ok := zips[t.Label]; ok {
+			t.Zip = zip
+			located = append(located, t)
+		}
+	}
+	sort.Slice(located, func(i, j int) bool { return located[i].ModulePath < located[j].ModulePath })
+	return located
+}
+
+// readArchivesFile returns the module path to zip mapping of an archivesFile.
+func readArchivesFile(path string) (map[string]string, error) {
+	var f archivesFile
+	if err := readJSONFile(path, &f); err != nil {
+		return nil, fmt.Errorf("failed to read archives: %w", err)
+	}
+	archives := map[string]string{}
+	for _, a := range f.Archives {
+		if other, ok := archives[a.ModulePath]; ok {
+			return nil, fmt.Errorf("%s: module %s has two archives, %s and %s", path, a.ModulePath, other, a.Zip)
+		}
+		archives[a.ModulePath] = a.Zip
+	}
+	return archives, nil
+}
+
+func runArchives(cfg ArchivesConfig, out io.Writer) error {
+	targets, err := readGoModTargets(cfg.Query)
+	if err != nil {
+		return fmt.Errorf("failed to read query output: %w", err)
+	}
+	zips, err := readBuiltZips(cfg.BEP)
+	if err != nil {
+		return fmt.Errorf("failed to read build events: %w", err)
+	}
+
+	located := locateArchives(targets, zips)
+	for _, t := range targets {
+		if _, ok := zips[t.Label]; !ok {
+			fmt.Fprintf(out, "%s: not built, skipping %s\n", t.Label, t.ModulePath)
+		}
+	}
+	for _, t := range located {
+		fmt.Fprintf(out, "%s %s\n", t.ModulePath, t.Zip)
+	}
+
+	if located == nil {
+		located = []moduleArchiveTarget{}
+	}
+	return writeJSON(cfg.Output, archivesFile{Archives: located})
+}
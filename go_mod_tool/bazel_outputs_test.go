@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadGoModTargets(t *testing.T) {
+	targets, err := readGoModTargets(testdata(t, "bazel", "query.jsonl"))
+	require.NoError(t, err)
+	assert.Equal(t, []moduleArchiveTarget{
+		{Label: "//mod_a:go_mod_zip", ModulePath: "github.com/stefanpenner/-bazel-go-mod-experiment/mod_a", GoMod: "//mod_a:go.mod"},
+		{Label: "//mod_b:go_mod_zip", ModulePath: "github.com/stefanpenner/-bazel-go-mod-experiment/mod_b", GoMod: "//mod_b:go.mod"},
+		{Label: "//tools:go_mod_zip", ModulePath: "github.com/stefanpenner/-bazel-go-mod-experiment/tools", GoMod: "//tools:go.mod"},
+	}, targets)
+}
+
+func TestReadBuiltZips(t *testing.T) {
+	zips, err := readBuiltZips(testdata(t, "bazel", "bep.json"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"//mod_a:go_mod_zip": "/home/user/.cache/bazel/execroot/_main/bazel-out/k8-fastbuild/bin/mod_a/go_mod_zip.zip",
+		"//mod_b:go_mod_zip": "bazel-out/k8-fastbuild/bin/mod_b/go_mod_zip.zip",
+	}, zips)
+}
+
+func TestReadBuiltZipsFailedTarget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bep.json")
+	require.NoError(t, os.WriteFile(path, []byte(
+		`{"id":{"targetCompleted":{"label":"//mod_a:go_mod_zip"}},"completed":{"success":false}}`+"\n"), 0644))
+	_, err := readBuiltZips(path)
+	assert.ErrorContains(t, err, "targets failed to build: //mod_a:go_mod_zip")
+}
+
+func TestNormalizeLabel(t *testing.T) {
+	tests := map[string]string{
+		"//mod_a:go_mod_zip":      "//mod_a:go_mod_zip",
+		"@//mod_a:go_mod_zip":     "//mod_a:go_mod_zip",
+		"@@//mod_a:go_mod_zip":    "//mod_a:go_mod_zip",
+		"@@rules_go//go:def.bzl":  "@@rules_go//go:def.bzl",
+		"@rules_go//go/tools:foo": "@rules_go//go/tools:foo",
+	}
+	for label, want := range tests {
+		assert.Equal(t, want, normalizeLabel(label), label)
+	}
+}
+
+func TestRunArchives(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "archives.json")
+	out := new(bytes.Buffer)
+	require.NoError(t, runArchives(ArchivesConfig{Query: testdata(t, "bazel", "query.jsonl"), BEP: testdata(t, "bazel", "bep.json"), Output: output}, out))
+	assert.Equal(t, `//tools:go_mod_zip: not built, skipping github.com/stefanpenner/-bazel-go-mod-experiment/tools
+github.com/stefanpenner/-bazel-go-mod-experiment/mod_a /home/user/.cache/bazel/execroot/_main/bazel-out/k8-fastbuild/bin/mod_a/go_mod_zip.zip
+github.com/stefanpenner/-bazel-go-mod-experiment/mod_b bazel-out/k8-fastbuild/bin/mod_b/go_mod_zip.zip
+`, out.String())
+
+	archives, err := readArchivesFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"github.com/stefanpenner/-bazel-go-mod-experiment/mod_a": "/home/user/.cache/bazel/execroot/_main/bazel-out/k8-fastbuild/bin/mod_a/go_mod_zip.zip",
+		"github.com/stefanpenner/-bazel-go-mod-experiment/mod_b": "bazel-out/k8-fastbuild/bin/mod_b/go_mod_zip.zip",
+	}, archives)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+type ChangedConfig struct {
+	RepoRoot        string
+	ImpactedTargets string
+	ChangedFiles    string
+	Format          string
+	GoModTarget     string
+	Dependents      bool
+}
+
+// changedResult is the JSON output of `go_mod_tool changed`.
+type changedResult struct {
+	Modules []*repoModule `json:"modules"`
+}
+
+// readLines returns the non-empty, trimmed lines of path, or of stdin when path is "-".
+func readLines(path string, stdin io.Reader) ([]string, error) {
+	var r io.Reader = stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// labelPackage returns the package of a label in the main repository, as
+// printed by bazel-diff (e.g. "//mod_a/foo:foo", "@@//mod_b", "//:gazelle").
+// Labels of external repositories are not part of any in-repo module.
+func labelPackage(label string) (string, bool) {
+	label = strings.TrimLeft(label, "@")
+	if !strings.HasPrefix(label, "//") {
+		return "", false
+	}
+	pkg, _, _ := strings.Cut(strings.TrimPrefix(label, "//"), ":")
+	if pkg == "" {
+		return ".", true
+	}
+	return pkg, true
+}
+
+// affectedModules maps changed bazel targets and files to the modules owning them.
+func affectedModules(modules []*repoModule, targets, files []string) []*repoModule {
+	affected := map[*repoModule]bool{}
+
+	for _, target := range targets {
+		pkg, ok := labelPackage(target)
+		if !ok {
+			continue
+		}
+		if m := moduleOwning(modules, pkg); m != nil {
+			affected[m] = true
+		}
+	}
+	for _, file := range files {
+		if m := moduleOwning(modules, file); m != nil {
+			affected[m] = true
+		}
+	}
+
+	result := []*repoModule{}
+	for m := range affected {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result
+}
+
+// readChanges reads the impacted targets and changed files lists, at least
+// one of which must be given.
+func readChanges(impactedTargets, changedFiles string, stdin io.Reader) (targets, files []string, err error) {
+	if impactedTargets == "" && changedFiles == "" {
+		return nil, nil, fmt.Errorf("one of --impacted-targets or --changed-files is required")
+	}
+	if impactedTargets == "-" && changedFiles == "-" {
+		// the second read would silently come back empty
+		return nil, nil, fmt.Errorf("--impacted-targets and --changed-files cannot both read stdin")
+	}
+	if impactedTargets != "" {
+		if targets, err = readLines(impactedTargets, stdin); err != nil {
+			return nil, nil, fmt.Errorf("failed to read impacted targets: %w", err)
+		}
+	}
+	if changedFiles != "" {
+		if files, err = readLines(changedFiles, stdin); err != nil {
+			return nil, nil, fmt.Errorf("failed to read changed files: %w", err)
+		}
+	}
+	return targets, files, nil
+}
+
+func runChanged(cfg ChangedConfig, stdin io.Reader, out io.Writer) error {
+	targets, files, err := readChanges(cfg.ImpactedTargets, cfg.ChangedFiles, stdin)
+	if err != nil {
+		return err
+	}
+
+	modules, err := findRepoModules(cfg.RepoRoot, cfg.GoModTarget)
+	if err != nil {
+		return fmt.Errorf("failed to find modules in %s: %w", cfg.RepoRoot, err)
+	}
+
+	affected := affectedModules(modules, targets, files)
+	if cfg.Dependents {
+		affected, err = newModuleGraph(modules).releaseSet(affected)
+		if err != nil {
+			return err
+		}
+	}
+
+	return printModules(out, cfg.Format, affected)
+}
+
+// printModules writes module paths one per line, or a changedResult as JSON.
+func printModules(out io.Writer, format string, modules []*repoModule) error {
+	switch format {
+	case "text":
+		for _, m := range modules {
+			fmt.Fprintln(out, m.Path)
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(changedResult{Modules: modules})
+	default:
+		return fmt.Errorf("unknown format %q, expected text or json", format)
+	}
+}
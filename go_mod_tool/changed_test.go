@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testdata returns the path of a fixture below testdata, skipping the test
+// when it is missing: the fixtures hold go.mod files of their own, so module
+// archives of go_mod_tool can't ship them.
+func testdata(t *testing.T, elem ...string) string {
+	t.Helper()
+	p := filepath.Join(append([]string{"testdata"}, elem...)...)
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		t.Skipf("%s is not available", p)
+	}
+	return p
+}
+
+func writeRepoFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+	return root
+}
+
+func TestFindRepoModules(t *testing.T) {
+	modules, err := findRepoModules(testdata(t, "changed", "repo"), defaultGoModTarget)
+	require.NoError(t, err)
+
+	var got []string
+	for _, m := range modules {
+		got = append(got, m.Dir+" "+m.Path+" "+m.Label)
+	}
+	assert.Equal(t, []string{
+		"foo/bar example.com/repo/foo/bar //foo/bar:go_mod_zip",
+		"mod_a example.com/repo/mod_a //mod_a:go_mod_zip",
+		"mod_a/nested example.com/repo/mod_a/nested //mod_a/nested:go_mod_zip",
+		"mod_b example.com/repo/mod_b //mod_b:go_mod_zip",
+	}, got)
+}
+
+func TestFindRepoModulesSkipsGoModWithoutModule(t *testing.T) {
+	root := writeRepoFiles(t, map[string]string{
+		"lib/go.mod":      "module example.com/lib\n",
+		"prefixed/go.mod": "go 1.23\n",
+	})
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	modules, err := findRepoModules(root, defaultGoModTarget)
+	require.NoError(t, err)
+	require.Len(t, modules, 1)
+	assert.Equal(t, "example.com/lib", modules[0].Path)
+	assert.Contains(t, logs.String(), filepath.Join(root, "prefixed", "go.mod")+": no module directive, skipping it")
+}
+
+func TestModuleOwning(t *testing.T) {
+	modules, err := findRepoModules(testdata(t, "changed", "repo"), defaultGoModTarget)
+	require.NoError(t, err)
+
+	tests := []struct {
+		rel  string
+		want string
+	}{
+		{"mod_a/foo/foo.go", "example.com/repo/mod_a"},
+		{"mod_a", "example.com/repo/mod_a"},
+		{"mod_a/nested/deep/deep.go", "example.com/repo/mod_a/nested"},
+		{"./mod_b/lib.go", "example.com/repo/mod_b"},
+		{"mod_bb/lib.go", ""},
+		{"README.md", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			m := moduleOwning(modules, tt.rel)
+			if tt.want == "" {
+				assert.Nil(t, m)
+				return
+			}
+			require.NotNil(t, m)
+			assert.Equal(t, tt.want, m.Path)
+		})
+	}
+
+	t.Run("root module owns everything else", func(t *testing.T) {
+		root := &repoModule{Path: "example.com/repo", Dir: "."}
+		withRoot := append([]*repoModule{root}, modules...)
+		assert.Equal(t, root, moduleOwning(withRoot, "README.md"))
+		assert.Equal(t, "example.com/repo/mod_b", moduleOwning(withRoot, "mod_b/lib.go").Path)
+	})
+}
+
+func TestLabelPackage(t *testing.T) {
+	tests := []struct {
+		label string
+		want  string
+		ok    bool
+	}{
+		{"//mod_a/foo:foo", "mod_a/foo", true},
+		{"@@//mod_b:go_mod_zip", "mod_b", true},
+		{"@//mod_b", "mod_b", true},
+		{"//:gazelle", ".", true},
+		{"@com_github_spf13_cobra//:cobra", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			got, ok := labelPackage(tt.label)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRunChanged(t *testing.T) {
+	repo := testdata(t, "changed", "repo")
+
+	t.Run("impacted targets as text", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		err := runChanged(ChangedConfig{
+			RepoRoot:        repo,
+			ImpactedTargets: testdata(t, "changed", "impacted_targets.txt"),
+			Format:          "text",
+			GoModTarget:     defaultGoModTarget,
+		}, nil, out)
+		require.NoError(t, err)
+		assert.Equal(t, "example.com/repo/mod_a\nexample.com/repo/mod_a/nested\nexample.com/repo/mod_b\n", out.String())
+	})
+
+	t.Run("changed files as json", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		err := runChanged(ChangedConfig{
+			RepoRoot:     repo,
+			ChangedFiles: testdata(t, "changed", "changed_files.txt"),
+			Format:       "json",
+			GoModTarget:  defaultGoModTarget,
+		}, nil, out)
+		require.NoError(t, err)
+
+		var got changedResult
+		require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		require.Len(t, got.Modules, 2)
+		assert.Equal(t, repoModule{Path: "example.com/repo/foo/bar", Dir: "foo/bar", Label: "//foo/bar:go_mod_zip"}, *got.Modules[0])
+		assert.Equal(t, repoModule{Path: "example.com/repo/mod_a/nested", Dir: "mod_a/nested", Label: "//mod_a/nested:go_mod_zip"}, *got.Modules[1])
+	})
+
+	t.Run("changed files from stdin", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		err := runChanged(ChangedConfig{
+			RepoRoot:     repo,
+			ChangedFiles: "-",
+			Format:       "text",
+			GoModTarget:  defaultGoModTarget,
+		}, strings.NewReader("mod_b/lib.go\n"), out)
+		require.NoError(t, err)
+		assert.Equal(t, "example.com/repo/mod_b\n", out.String())
+	})
+
+	t.Run("no input", func(t *testing.T) {
+		err := runChanged(ChangedConfig{RepoRoot: repo, Format: "text"}, nil, new(bytes.Buffer))
+		assert.ErrorContains(t, err, "--impacted-targets or --changed-files")
+	})
+
+	t.Run("both lists from stdin", func(t *testing.T) {
+		err := runChanged(ChangedConfig{
+			RepoRoot:        repo,
+			ImpactedTargets: "-",
+			ChangedFiles:    "-",
+			Format:          "text",
+			GoModTarget:     defaultGoModTarget,
+		}, strings.NewReader("//mod_b:mod_b\n"), new(bytes.Buffer))
+		assert.ErrorContains(t, err, "cannot both read stdin")
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		err := runChanged(ChangedConfig{
+			RepoRoot:     repo,
+			ChangedFiles: testdata(t, "changed", "changed_files.txt"),
+			Format:       "yaml",
+		}, nil, new(bytes.Buffer))
+		assert.ErrorContains(t, err, "unknown format")
+	})
+}
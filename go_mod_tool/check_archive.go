@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+type CheckArchiveConfig struct {
+	Zip         string
+	ModulePath  string
+	SrcFiles    []string
+	StripPrefix string
+	Exclude     []string
+}
+
+// checkArchive checks a built module archive against the sources its go_mod
+// rule was given, and returns every problem found:
+//
+//   - every entry is inside one module@version directory of the module
+//   - go.mod declares the module path
+//   - no entry appears twice
+//   - no Bazel files were packaged
+//   - the files are exactly go.mod and the sources not matching an exclude
+//     pattern
+func checkArchive(zr *zip.Reader, cfg CheckArchiveConfig) ([]string, error) {
+	modulePath, version, err := archiveModuleVersion(zr)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+
+	var problems []string
+	if modulePath != cfg.ModulePath {
+		problems = append(problems, fmt.Sprintf("archive is for module %s, expected %s", modulePath, cfg.ModulePath))
+	}
+	prefix := modulePath + "@" + version + "/"
+
+	if data, err := readZipFile(zr, prefix+"go.mod"); err != nil {
+		problems = append(problems, err.Error())
+	} else if f, err := modfile.ParseLax("go.mod", data, nil); err != nil {
+		problems = append(problems, fmt.Sprintf("go.mod: %v", err))
+	} else if f.Module == nil || f.Module.Mod.Path != cfg.ModulePath {
+		problems = append(problems, fmt.Sprintf("go.mod does not declare module %s", cfg.ModulePath))
+	}
+
+	// the expected files are worked out here rather than with excludeSrcs,
+	// so a packaging change that lets Bazel files through is caught
+	for _, p := range cfg.Exclude {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", p, err)
+		}
+	}
+	expected := map[string]bool{"go.mod": true}
+	for _, src := range cfg.SrcFiles {
+		rel := filepath.ToSlash(stripPathPrefix(src, cfg.StripPrefix))
+		if !isBazelFile(rel) && !excluded(rel, cfg.Exclude) {
+			expected[rel] = true
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(f.Name, prefix)
+		switch {
+		case seen[name]:
+			problems = append(problems, fmt.Sprintf("%s appears more than once", name))
+			continue
+		case isBazelFile(name):
+			problems = append(problems, fmt.Sprintf("%s is a Bazel file", name))
+		case !expected[name]:
+			problems = append(problems, fmt.Sprintf("%s is not one of the module's sources", name))
+		}
+		seen[name] = true
+	}
+
+	var missing []string
+	for name := range expected {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		problems = append(problems, fmt.Sprintf("%s is missing", name))
+	}
+	return problems, nil
+}
+
+func runCheckArchive(cfg CheckArchiveConfig, out io.Writer) error {
+	zr, err := zip.OpenReader(cfg.Zip)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	problems, err := checkArchive(&zr.Reader, cfg)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Fprintf(out, "%s: %s\n", cfg.Zip, p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s does not match its go_mod rule", cfg.Zip)
+	}
+	fmt.Fprintf(out, "%s: ok\n", cfg.Zip)
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckArchive(t *testing.T) {
+	const prefix = "example.com/mod@v1.0.0/"
+	const goMod = "module example.com/mod\n"
+
+	cfg := CheckArchiveConfig{
+		ModulePath:  "example.com/mod",
+		SrcFiles:    []string{"mod/BUILD.bazel", "mod/go.mod", "mod/lib.go", "mod/sub/sub.go", "mod/testdata/golden.txt"},
+		StripPrefix: "mod",
+		Exclude:     []string{"testdata"},
+	}
+
+	tests := []struct {
+		name    string
+		entries [][2]string
+		want    []string
+	}{
+		{
+			name: "matches the sources",
+			entries: [][2]string{
+				{prefix + "go.mod", goMod},
+				{prefix + "lib.go", "package mod"},
+				{prefix + "sub/sub.go", "package sub"},
+			},
+		},
+		{
+			name: "missing, unexpected, duplicate and bazel files",
+			entries: [][2]string{
+				{prefix + "go.mod", goMod},
+				{prefix + "lib.go", "package mod"},
+				{prefix + "lib.go", "package mod"},
+				{prefix + "BUILD.bazel", ""},
+				{prefix + "rules/defs.bzl", ""},
+				{prefix + "testdata/golden.txt", ""},
+			},
+			want: []string{
+				"lib.go appears more than once",
+				"BUILD.bazel is a Bazel file",
+				"rules/defs.bzl is a Bazel file",
+				"testdata/golden.txt is not one of the module's sources",
+				"sub/sub.go is missing",
+			},
+		},
+		{
+			name: "wrong module line",
+			entries: [][2]string{
+				{prefix + "go.mod", "module example.com/other\n"},
+				{prefix + "lib.go", "package mod"},
+				{prefix + "sub/sub.go", "package sub"},
+			},
+			want: []string{"go.mod does not declare module example.com/mod"},
+		},
+		{
+			name: "wrong module",
+			entries: [][2]string{
+				{"example.com/other@v1.0.0/go.mod", goMod},
+				{"example.com/other@v1.0.0/lib.go", "package mod"},
+				{"example.com/other@v1.0.0/sub/sub.go", "package sub"},
+			},
+			want: []string{"archive is for module example.com/other, expected example.com/mod"},
+		},
+		{
+			name: "entries outside the module directory",
+			entries: [][2]string{
+				{prefix + "go.mod", goMod},
+				{"lib.go", "package mod"},
+			},
+			want: []string{`archive entry "lib.go" is not inside example.com/mod@v1.0.0/`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			zw := zip.NewWriter(buf)
+			for _, e := range tt.entries {
+				w, err := zw.Create(e[0])
+				require.NoError(t, err)
+				_, err = w.Write([]byte(e[1]))
+				require.NoError(t, err)
+			}
+			require.NoError(t, zw.Close())
+			zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			require.NoError(t, err)
+
+			got, err := checkArchive(zr, cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRunCheckArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	zipPath := filepath.Join(tmpDir, "mod.zip")
+	writeTestZip(t, zipPath, map[string]string{
+		"example.com/mod@v1.0.0/go.mod": "module example.com/mod\n",
+		"example.com/mod@v1.0.0/lib.go": "package mod",
+	})
+
+	var out bytes.Buffer
+	cfg := CheckArchiveConfig{Zip: zipPath, ModulePath: "example.com/mod", SrcFiles: []string{"mod/lib.go"}, StripPrefix: "mod"}
+	require.NoError(t, runCheckArchive(cfg, &out))
+	assert.Equal(t, zipPath+": ok\n", out.String())
+
+	out.Reset()
+	cfg.SrcFiles = append(cfg.SrcFiles, "mod/extra.go")
+	assert.EqualError(t, runCheckArchive(cfg, &out), zipPath+" does not match its go_mod rule")
+	assert.Equal(t, zipPath+": extra.go is missing\n", out.String())
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/spf13/cobra"
 )
 
@@ -8,9 +10,17 @@ type Config struct {
 	Output             string
 	ModulePath         string
 	VolatileStatusFile string
+	StableStatusFile   string
+	StrictStatus       bool
+	VersionTemplate    string
 	GoMod              string
 	SrcFiles           []string
 	StripPrefix        string
+	Exclude            []string
+	Label              string
+	ProvenanceOutput   string
+	SPDXOutput         string
+	CycloneDXOutput    string
 }
 
 func cmd() *cobra.Command {
@@ -26,17 +36,412 @@ func cmd() *cobra.Command {
 
 	command.Flags().StringVar(&cfg.Output, "output", "", "Path to output .zip file")
 	command.Flags().StringVar(&cfg.ModulePath, "module-path", "", "Module path (e.g., github.com/my_project)")
-	command.Flags().StringVar(&cfg.VolatileStatusFile, "volatile-status-file", "", "Path to a file that will be stamped with the current timestamp")
+	command.Flags().StringVar(&cfg.VolatileStatusFile, "volatile-status-file", "", "Path to bazel's volatile-status.txt")
+	command.Flags().StringVar(&cfg.StableStatusFile, "stable-status-file", "", "Path to bazel's stable-status.txt, its keys take precedence over the volatile ones")
+	command.Flags().BoolVar(&cfg.StrictStatus, "strict-status", false, "Fail when a status file defines the same key twice")
+	command.Flags().StringVar(&cfg.VersionTemplate, "version-template", "", "Module version built from status keys, e.g. v0.0.0-{BUILD_TIMESTAMP}-{STABLE_GIT_COMMIT:12} (defaults to VOLATILE_VERSION)")
 	command.Flags().StringVar(&cfg.GoMod, "go-mod", "", "Path to go.mod file")
 	command.Flags().StringSliceVar(&cfg.SrcFiles, "src", nil, "Path to a .go source file (can be repeated)")
 	command.Flags().StringVar(&cfg.StripPrefix, "strip-prefix", "", "Prefix to strip from source file paths")
+	command.Flags().StringSliceVar(&cfg.Exclude, "exclude", nil, "Glob of module relative paths to leave out of the archive, matching a directory excludes everything below it (can be repeated)")
+	command.Flags().StringVar(&cfg.Label, "label", "", "Bazel label of the go_mod target, recorded in the provenance")
+	command.Flags().StringVar(&cfg.ProvenanceOutput, "provenance-output", "", "Path to write the SLSA provenance statement to")
+	command.Flags().StringVar(&cfg.SPDXOutput, "spdx-output", "", "Path to write the SPDX 2.3 JSON SBOM to")
+	command.Flags().StringVar(&cfg.CycloneDXOutput, "cyclonedx-output", "", "Path to write the CycloneDX JSON SBOM to")
 
 	// Mark required flags
 	command.MarkFlagRequired("output")
 	command.MarkFlagRequired("module-path")
-	command.MarkFlagRequired("volatile-status-file")
 	command.MarkFlagRequired("go-mod")
 	command.MarkFlagRequired("src")
 
+	command.AddCommand(signCmd())
+	command.AddCommand(stampCmd())
+	command.AddCommand(verifySignatureCmd())
+	command.AddCommand(generateKeyCmd())
+	command.AddCommand(changedCmd())
+	command.AddCommand(planVersionsCmd())
+	command.AddCommand(checkAPICmd())
+	command.AddCommand(checkArchiveCmd())
+	command.AddCommand(manifestCmd())
+	command.AddCommand(archivesCmd())
+	command.AddCommand(planCmd())
+	command.AddCommand(applyCmd())
+	command.AddCommand(syncGoWorkCmd())
+
+	return command
+}
+
+func signCmd() *cobra.Command {
+	var cfg SignConfig
+
+	command := &cobra.Command{
+		Use:   "sign",
+		Short: "Write a detached signature of a built module archive",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSign(cfg)
+		},
+	}
+
+	command.Flags().StringVar(&cfg.Zip, "zip", "", "Path to the module .zip")
+	command.Flags().StringVar(&cfg.SigningKey, "signing-key", "", "Path to a sumdb/note private key")
+	command.Flags().StringVar(&cfg.SigningKeyEnv, "signing-key-env", "", "Environment variable holding a sumdb/note private key")
+	command.Flags().StringVar(&cfg.Output, "output", "", "Path to write the detached signature to")
+
+	command.MarkFlagRequired("zip")
+	command.MarkFlagRequired("output")
+	command.MarkFlagsOneRequired("signing-key", "signing-key-env")
+	command.MarkFlagsMutuallyExclusive("signing-key", "signing-key-env")
+
+	return command
+}
+
+func stampCmd() *cobra.Command {
+	var cfg StampConfig
+
+	command := &cobra.Command{
+		Use:   "stamp",
+		Short: "Stamp an unstamped content archive with its version, rewriting the path prefix and go.mod",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStamp(cfg)
+		},
+	}
+
+	command.Flags().StringVar(&cfg.Input, "input", "", "Path to the unstamped content .zip")
+	command.Flags().StringVar(&cfg.Output, "output", "", "Path to the stamped output .zip")
+	command.Flags().StringVar(&cfg.Manifest, "manifest", "", "Version manifest to take the module's version and its in-repo requirements' versions from")
+	command.Flags().StringVar(&cfg.VolatileStatusFile, "volatile-status-file", "", "Path to bazel's volatile-status.txt")
+	command.Flags().StringVar(&cfg.StableStatusFile, "stable-status-file", "", "Path to bazel's stable-status.txt, its keys take precedence over the volatile ones")
+	command.Flags().BoolVar(&cfg.StrictStatus, "strict-status", false, "Fail when a status file defines the same key twice")
+	command.Flags().StringVar(&cfg.VersionTemplate, "version-template", "", "Module version built from status keys, used without --manifest (defaults to VOLATILE_VERSION)")
+	command.Flags().StringVar(&cfg.Label, "label", "", "Bazel label of the go_mod target, recorded in the provenance")
+	command.Flags().StringVar(&cfg.ProvenanceOutput, "provenance-output", "", "Path to write the SLSA provenance statement to")
+	command.Flags().StringVar(&cfg.SPDXOutput, "spdx-output", "", "Path to write the SPDX 2.3 JSON SBOM to")
+	command.Flags().StringVar(&cfg.CycloneDXOutput, "cyclonedx-output", "", "Path to write the CycloneDX JSON SBOM to")
+
+	command.MarkFlagRequired("input")
+	command.MarkFlagRequired("output")
+
+	return command
+}
+
+func verifySignatureCmd() *cobra.Command {
+	var cfg VerifySignatureConfig
+
+	command := &cobra.Command{
+		Use:   "verify-signature",
+		Short: "Verify a module archive against its detached signature and a set of trusted keys",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVerifySignature(cfg, cmd.OutOrStdout())
+		},
+	}
+
+	command.Flags().StringVar(&cfg.Zip, "zip", "", "Path to the module .zip")
+	command.Flags().StringVar(&cfg.Mod, "mod", "", "Path to the module .mod file (defaults to the go.mod inside the .zip)")
+	command.Flags().StringVar(&cfg.Signature, "signature", "", "Path to the detached signature")
+	command.Flags().StringSliceVar(&cfg.TrustedKeys, "trusted-keys", nil, "Path to a file of trusted verifier keys, one per line (can be repeated)")
+
+	command.MarkFlagRequired("zip")
+	command.MarkFlagRequired("signature")
+	command.MarkFlagRequired("trusted-keys")
+
+	return command
+}
+
+func generateKeyCmd() *cobra.Command {
+	var cfg GenerateKeyConfig
+
+	command := &cobra.Command{
+		Use:   "generate-key",
+		Short: "Generate a sumdb/note key pair for signing module archives",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGenerateKey(cfg)
+		},
+	}
+
+	command.Flags().StringVar(&cfg.Name, "name", "", "Key name (e.g., ci.example.com)")
+	command.Flags().StringVar(&cfg.PrivateKeyOutput, "private-key-output", "", "Path to write the private key to")
+	command.Flags().StringVar(&cfg.PublicKeyOutput, "public-key-output", "", "Path to write the public verifier key to")
+
+	command.MarkFlagRequired("name")
+	command.MarkFlagRequired("private-key-output")
+	command.MarkFlagRequired("public-key-output")
+
+	return command
+}
+
+// defaultRepoRoot is the workspace `bazel run` was invoked from, or the
+// current directory.
+func defaultRepoRoot() string {
+	if dir := os.Getenv("BUILD_WORKSPACE_DIRECTORY"); dir != "" {
+		return dir
+	}
+	return "."
+}
+
+func changedCmd() *cobra.Command {
+	var cfg ChangedConfig
+
+	command := &cobra.Command{
+		Use:   "changed",
+		Short: "Map changed files or bazel-diff impacted targets to the modules that own them",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runChanged(cfg, cmd.InOrStdin(), cmd.OutOrStdout())
+		},
+	}
+
+	command.Flags().StringVar(&cfg.RepoRoot, "repo-root", defaultRepoRoot(), "Repository root to look for go.mod files in")
+	command.Flags().StringVar(&cfg.ImpactedTargets, "impacted-targets", "", "Path to bazel-diff's impacted targets output, one label per line (- for stdin)")
+	command.Flags().StringVar(&cfg.ChangedFiles, "changed-files", "", "Path to a list of changed files relative to the repository root (- for stdin)")
+	command.Flags().StringVar(&cfg.Format, "format", "text", "Output format: text or json")
+	command.Flags().StringVar(&cfg.GoModTarget, "go-mod-target", defaultGoModTarget, "Name of the go_mod rule in each module's package")
+	command.Flags().BoolVar(&cfg.Dependents, "dependents", false, "Also include modules that transitively depend on an affected module, in release order")
+
+	return command
+}
+
+func planVersionsCmd() *cobra.Command {
+	var cfg PlanVersionsConfig
+
+	command := &cobra.Command{
+		Use:   "plan-versions",
+		Short: "Propose new module versions from the conventional commits touching each affected module",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPlanVersions(cfg, cmd.InOrStdin(), cmd.OutOrStdout())
+		},
+	}
+
+	command.Flags().StringVar(&cfg.RepoRoot, "repo-root", defaultRepoRoot(), "Repository root (a git checkout)")
+	command.Flags().StringVar(&cfg.Manifest, "manifest", "", "Path to the previous version manifest")
+	command.Flags().StringVar(&cfg.VersionSource, "version-source", "", "Where previous versions are published: manifest:<path>, goproxy:<url> or git:<repo> (defaults to --manifest)")
+	command.Flags().StringVar(&cfg.Affected, "affected", "", "Path to the output of `changed --format json` (- for stdin)")
+	command.Flags().StringVar(&cfg.Since, "since", "", "Git revision of the previous release, only commits after it are considered (defaults to the commit the manifest records for each module's version)")
+	command.Flags().StringVar(&cfg.Output, "output", "", "Path to write the updated version manifest to")
+	command.Flags().StringVar(&cfg.GoModTarget, "go-mod-target", defaultGoModTarget, "Name of the go_mod rule in each module's package")
+
+	command.MarkFlagRequired("affected")
+	command.MarkFlagRequired("output")
+
+	return command
+}
+
+func checkAPICmd() *cobra.Command {
+	var cfg CheckAPIConfig
+
+	command := &cobra.Command{
+		Use:   "check-api",
+		Short: "Fail when a module archive's API changes need a bigger version bump than it got",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCheckAPI(cfg, cmd.OutOrStdout())
+		},
+	}
+
+	command.Flags().StringVar(&cfg.Zip, "zip", "", "Path to the module .zip being released")
+	command.Flags().StringVar(&cfg.ProxyDir, "proxy-dir", "", "Local GOPROXY directory holding the published versions")
+	command.Flags().StringVar(&cfg.Previous, "previous", "", "Version to compare against (defaults to the highest published version below the new one)")
+	command.Flags().StringVar(&cfg.Version, "version", "", "Version being released (defaults to the version in the archive)")
+
+	command.MarkFlagRequired("zip")
+	command.MarkFlagRequired("proxy-dir")
+
+	return command
+}
+
+func checkArchiveCmd() *cobra.Command {
+	var cfg CheckArchiveConfig
+
+	command := &cobra.Command{
+		Use:   "check-archive",
+		Short: "Check a built module archive against the sources of its go_mod rule",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCheckArchive(cfg, cmd.OutOrStdout())
+		},
+	}
+
+	command.Flags().StringVar(&cfg.Zip, "zip", "", "Path to the module .zip")
+	command.Flags().StringVar(&cfg.ModulePath, "module-path", "", "Module path the archive must be for")
+	command.Flags().StringSliceVar(&cfg.SrcFiles, "src", nil, "Path of a source given to the go_mod rule (can be repeated)")
+	command.Flags().StringVar(&cfg.StripPrefix, "strip-prefix", "", "Prefix stripped from source file paths")
+	command.Flags().StringSliceVar(&cfg.Exclude, "exclude", nil, "Exclude glob given to the go_mod rule (can be repeated)")
+
+	command.MarkFlagRequired("zip")
+	command.MarkFlagRequired("module-path")
+
+	return command
+}
+
+func syncGoWorkCmd() *cobra.Command {
+	var cfg SyncGoWorkConfig
+
+	command := &cobra.Command{
+		Use:   "sync-go-work",
+		Short: "Make go.work use every module of the repository",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSyncGoWork(cfg, cmd.OutOrStdout())
+		},
+	}
+
+	command.Flags().StringVar(&cfg.RepoRoot, "repo-root", defaultRepoRoot(), "Repository root to look for go.mod files in")
+	command.Flags().StringVar(&cfg.GoWork, "go-work", "", "Path to the go.work file (defaults to go.work in the repository root)")
+	command.Flags().BoolVar(&cfg.Check, "check", false, "Fail instead of rewriting go.work when its use directives are out of date")
+
+	return command
+}
+
+func manifestCmd() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "manifest",
+		Short: "Inspect and combine version manifests",
+	}
+
+	command.AddCommand(manifestShowCmd())
+	command.AddCommand(manifestValidateCmd())
+	command.AddCommand(manifestMergeCmd())
+	command.AddCommand(manifestDiffCmd())
+
+	return command
+}
+
+func manifestShowCmd() *cobra.Command {
+	var cfg ManifestShowConfig
+
+	command := &cobra.Command{
+		Use:   "show <manifest>",
+		Short: "Print the modules and versions recorded in a manifest",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runManifestShow(cfg, args[0], cmd.OutOrStdout())
+		},
+	}
+
+	command.Flags().StringVar(&cfg.Format, "format", "text", "Output format: text or json")
+
+	return command
+}
+
+func manifestValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate <manifest>...",
+		Short: "Check manifests against the schema and report every problem found",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runManifestValidate(args, cmd.OutOrStdout())
+		},
+	}
+}
+
+func manifestMergeCmd() *cobra.Command {
+	var cfg ManifestMergeConfig
+
+	command := &cobra.Command{
+		Use:   "merge <manifest>...",
+		Short: "Merge manifests from left to right, refusing version regressions and conflicting releases",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runManifestMerge(cfg, args)
+		},
+	}
+
+	command.Flags().StringVar(&cfg.Output, "output", "", "Path to write the merged manifest to")
+
+	command.MarkFlagRequired("output")
+
+	return command
+}
+
+func manifestDiffCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff <old> <new>",
+		Short: "List the modules added, removed or changed between two manifests",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runManifestDiff(args[0], args[1], cmd.OutOrStdout())
+		},
+	}
+}
+
+func archivesCmd() *cobra.Command {
+	var cfg ArchivesConfig
+
+	command := &cobra.Command{
+		Use:   "archives",
+		Short: "Find the .zip built for each go_mod target from bazel query and build event output",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runArchives(cfg, cmd.OutOrStdout())
+		},
+	}
+
+	command.Flags().StringVar(&cfg.Query, "query", "", "Path to the output of `bazel query --output=streamed_jsonproto` over the go_mod targets")
+	command.Flags().StringVar(&cfg.BEP, "bep", "", "Path to the --build_event_json_file of the build of those targets")
+	command.Flags().StringVar(&cfg.Output, "output", "", "Path to write the module archives to, for `go_mod_tool plan --archives`")
+
+	command.MarkFlagRequired("query")
+	command.MarkFlagRequired("bep")
+	command.MarkFlagRequired("output")
+
+	return command
+}
+
+func planCmd() *cobra.Command {
+	var cfg PlanConfig
+
+	command := &cobra.Command{
+		Use:   "plan",
+		Short: "Plan a release: the modules affected by a change, their dependents and their new versions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPlan(cfg, cmd.InOrStdin(), cmd.OutOrStdout())
+		},
+	}
+
+	command.Flags().StringVar(&cfg.RepoRoot, "repo-root", defaultRepoRoot(), "Repository root (a git checkout)")
+	command.Flags().StringVar(&cfg.ImpactedTargets, "impacted-targets", "", "Path to bazel-diff's impacted targets output, one label per line (- for stdin)")
+	command.Flags().StringVar(&cfg.ChangedFiles, "changed-files", "", "Path to a list of changed files relative to the repository root (- for stdin)")
+	command.Flags().StringVar(&cfg.GoModTarget, "go-mod-target", defaultGoModTarget, "Name of the go_mod rule in each module's package")
+	command.Flags().StringVar(&cfg.Manifest, "manifest", "", "Path to the current version manifest")
+	command.Flags().StringVar(&cfg.VersionSource, "version-source", "", "Where previous versions are published: manifest:<path>, goproxy:<url> or git:<repo> (defaults to --manifest)")
+	command.Flags().StringVar(&cfg.Since, "since", "", "Git revision of the previous release, only commits after it are considered (defaults to the commit the manifest records for each module's version)")
+	command.Flags().StringToStringVar(&cfg.Archives, "archive", nil, "Module archive to publish, as module_path=path/to/module.zip (can be repeated)")
+	command.Flags().StringVar(&cfg.ArchivesFile, "archives", "", "Path to the module archives found by `go_mod_tool archives`")
+	command.Flags().StringVar(&cfg.Output, "output", "", "Path to write the release plan to")
+	command.Flags().StringVar(&cfg.ManifestOutput, "manifest-output", "", "Path to write the manifest with the planned versions to")
+
+	command.MarkFlagRequired("output")
+
+	return command
+}
+
+func applyCmd() *cobra.Command {
+	var cfg ApplyConfig
+
+	command := &cobra.Command{
+		Use:   "apply",
+		Short: "Publish the releases of a plan, resuming an interrupted run",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runApply(cfg, cmd.OutOrStdout())
+		},
+	}
+
+	command.Flags().StringVar(&cfg.Plan, "plan", "", "Path to the plan written by `go_mod_tool plan`")
+	command.Flags().StringVar(&cfg.Backend, "backend", "", "Where to publish: dir:<path> for a local proxy directory")
+	command.Flags().StringVar(&cfg.Progress, "progress", "", "Path to record progress in (defaults to the plan path with .progress appended)")
+	command.Flags().StringVar(&cfg.Manifest, "manifest", "", "Version manifest to update with the published versions, hashes and times")
+	command.Flags().StringVar(&cfg.VersionSource, "version-source", "", "Where versions are published: manifest:<path>, goproxy:<url> or git:<repo>; versions it lists that the backend doesn't have are not published again")
+	command.Flags().StringVar(&cfg.GoModTarget, "go-mod-target", defaultGoModTarget, "Name of the go_mod rule in each module's package")
+
+	command.MarkFlagRequired("plan")
+	command.MarkFlagRequired("backend")
+
 	return command
 }
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// goModExcludeDirective is the go_mod gazelle directive setting the exclude
+// attribute of the generated go_mod rules, see gazelle_languages/go_mod.
+const goModExcludeDirective = "gazelle:go_mod_exclude"
+
+// bazelBuildFileNames are the build file names gazelle reads directives from,
+// in the order it looks for them.
+var bazelBuildFileNames = []string{"BUILD.bazel", "BUILD"}
+
+// moduleContentHash hashes the files of module m that go into its archive.
+// Unlike the go.sum hash of a module zip, whose file names all start with
+// module@version/, it only depends on the paths relative to the module root
+// and the file contents, so it stays the same across versions for as long as
+// the module itself doesn't change.
+//
+// The files are the ones git tracks, as they are in the working tree, less
+// what excludeSrcs leaves out of the archive: Bazel files and the paths
+// matching the module's go_mod_exclude directives. Nested modules, hidden
+// directories and bazel convenience symlinks are not part of the module.
+func moduleContentHash(repoRoot string, m *repoModule, modules []*repoModule) (string, error) {
+	root := filepath.Join(repoRoot, filepath.FromSlash(m.Dir))
+	var nested []string
+	for _, other := range modules {
+		if m.contains(other) {
+			rel := strings.TrimPrefix(other.Dir, m.Dir+"/")
+			if m.Dir == "." {
+				rel = other.Dir
+			}
+			nested = append(nested, rel)
+		}
+	}
+
+	tracked, err := gitTrackedFiles(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to list the files of %s: %w", m.Path, err)
+	}
+	var files []string
+	for _, rel := range tracked {
+		if inModule(rel, nested) {
+			files = append(files, rel)
+		}
+	}
+
+	patterns, err := inheritedDirectives(repoRoot, m.Dir, goModExcludeDirective)
+	if err != nil {
+		return "", err
+	}
+	if files, err = excludeSrcs(files, "", patterns); err != nil {
+		return "", err
+	}
+
+	// tracked files deleted from the working tree, and symlinks, aren't
+	// packaged
+	var regular []string
+	for _, rel := range files {
+		fi, err := os.Lstat(filepath.Join(root, filepath.FromSlash(rel)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode().IsRegular() {
+			regular = append(regular, rel)
+		}
+	}
+
+	sort.Strings(regular)
+	return dirhash.Hash1(regular, func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(root, filepath.FromSlash(name)))
+	})
+}
+
+// inModule reports whether rel, relative to a module root, belongs to the
+// module rather than to one of the nested modules, a hidden directory or a
+// bazel convenience symlink.
+func inModule(rel string, nested []string) bool {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		name := path.Base(dir)
+		if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "bazel-") {
+			return false
+		}
+		for _, n := range nested {
+			if dir == n {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// gitTrackedFiles returns the files below dir that git tracks, relative to
+// dir and slash separated.
+func gitTrackedFiles(dir string) ([]string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "-C", dir, "ls-files", "-z", "--cached", "--", ".")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var files []string
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// inheritedDirectives returns the values of the gazelle directive key in the
+// build files of the repository root and every directory down to dir, in that
+// order, the way gazelle applies them to dir.
+func inheritedDirectives(repoRoot, dir, key string) ([]string, error) {
+	parts := []string{""}
+	if dir != "." {
+		parts = append(parts, strings.Split(dir, "/")...)
+	}
+	var values []string
+	rel := ""
+	for _, part := range parts {
+		rel = path.Join(rel, part)
+		v, err := readDirectives(filepath.Join(repoRoot, filepath.FromSlash(rel)), key)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v...)
+	}
+	return values, nil
+}
+
+// readDirectives returns the values of the single valued gazelle directive
+// key, e.g. "gazelle:go_mod_exclude", in the build file of dir.
+func readDirectives(dir, key string) ([]string, error) {
+	for _, name := range bazelBuildFileNames {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var values []string
+		for _, line := range strings.Split(string(data), "\n") {
+			comment, ok := strings.CutPrefix(strings.TrimSpace(line), "#")
+			if !ok {
+				continue
+			}
+			if fields := strings.Fields(comment); len(fields) == 2 && fields[0] == key {
+				values = append(values, fields[1])
+			}
+		}
+		return values, nil
+	}
+	return nil, nil
+}
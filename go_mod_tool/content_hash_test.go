@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleContentHash(t *testing.T) {
+	writeFiles := func(root string, files map[string]string) {
+		for name, content := range files {
+			p := filepath.Join(root, name)
+			require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+			require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+		}
+	}
+	hash := func(root string) string {
+		modules, err := findRepoModules(root, defaultGoModTarget)
+		require.NoError(t, err)
+		var lib *repoModule
+		for _, m := range modules {
+			if m.Dir == "lib" {
+				lib = m
+			}
+		}
+		require.NotNil(t, lib)
+		h, err := moduleContentHash(root, lib, modules)
+		require.NoError(t, err)
+		return h
+	}
+
+	root, git := gitRepo(t)
+	writeFiles(root, map[string]string{
+		"lib/go.mod":        "module example.com/lib\n",
+		"lib/lib.go":        "package lib\n",
+		"lib/sub/sub.go":    "package sub\n",
+		"lib/nested/go.mod": "module example.com/lib/nested\n",
+	})
+	git("add", ".")
+	base := hash(root)
+	assert.True(t, validHash(base), base)
+
+	// the same content elsewhere hashes the same
+	other, otherGit := gitRepo(t)
+	writeFiles(other, map[string]string{
+		"lib/go.mod":     "module example.com/lib\n",
+		"lib/lib.go":     "package lib\n",
+		"lib/sub/sub.go": "package sub\n",
+	})
+	otherGit("add", ".")
+	assert.Equal(t, base, hash(other))
+
+	// nested modules, hidden directories and other modules don't count
+	writeFiles(root, map[string]string{
+		"lib/nested/nested.go": "package nested\n",
+		"lib/.cache/state":     "x",
+		"app/go.mod":           "module example.com/app\n",
+	})
+	git("add", ".")
+	assert.Equal(t, base, hash(root))
+
+	// nor do files the archive leaves out: untracked files, Bazel files,
+	// and paths matching a go_mod_exclude directive of the module or above it
+	writeFiles(root, map[string]string{
+		"lib/untracked.go":       "package lib\n",
+		"BUILD.bazel":            "# gazelle:go_mod_exclude testdata\n",
+		"lib/BUILD.bazel":        "# gazelle:go_mod_exclude *_test.go\n",
+		"lib/defs.bzl":           "",
+		"lib/lib_test.go":        "package lib\n",
+		"lib/testdata/input.txt": "x",
+	})
+	git("add", "BUILD.bazel", "lib/BUILD.bazel", "lib/defs.bzl", "lib/lib_test.go", "lib/testdata")
+	assert.Equal(t, base, hash(root))
+
+	writeFiles(root, map[string]string{"lib/lib.go": "package lib\n\nfunc New() {}\n"})
+	assert.NotEqual(t, base, hash(root))
+}
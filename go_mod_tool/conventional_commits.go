@@ -0,0 +1,77 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// bumpKind is how much of a version a set of changes requires bumping.
+type bumpKind int
+
+const (
+	bumpNone bumpKind = iota
+	bumpPatch
+	bumpMinor
+	bumpMajor
+)
+
+func (b bumpKind) String() string {
+	switch b {
+	case bumpPatch:
+		return "patch"
+	case bumpMinor:
+		return "minor"
+	case bumpMajor:
+		return "major"
+	default:
+		return "none"
+	}
+}
+
+// conventionalCommit is the part of a https://www.conventionalcommits.org
+// message that decides a version bump.
+type conventionalCommit struct {
+	Type     string
+	Scope    string
+	Subject  string
+	Breaking bool
+}
+
+var (
+	commitHeaderPattern   = regexp.MustCompile(`^([A-Za-z]+)(?:\(([^()]*)\))?(!)?: (.+)$`)
+	breakingFooterPattern = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: `)
+)
+
+// parseConventionalCommit parses a commit message. Messages that don't follow
+// the convention are returned with an empty Type.
+func parseConventionalCommit(message string) conventionalCommit {
+	header, body, _ := strings.Cut(strings.TrimSpace(message), "\n")
+
+	var c conventionalCommit
+	if m := commitHeaderPattern.FindStringSubmatch(strings.TrimSpace(header)); m != nil {
+		c.Type = strings.ToLower(m[1])
+		c.Scope = m[2]
+		c.Breaking = m[3] == "!"
+		c.Subject = m[4]
+	} else {
+		c.Subject = strings.TrimSpace(header)
+	}
+	if breakingFooterPattern.MatchString(body) {
+		c.Breaking = true
+	}
+	return c
+}
+
+// bump is the version bump this commit asks for on its own.
+func (c conventionalCommit) bump() bumpKind {
+	switch {
+	case c.Breaking:
+		return bumpMajor
+	case c.Type == "feat":
+		return bumpMinor
+	case c.Type == "fix" || c.Type == "perf" || c.Type == "revert":
+		return bumpPatch
+	default:
+		return bumpNone
+	}
+}
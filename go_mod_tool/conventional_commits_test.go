@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConventionalCommit(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    conventionalCommit
+		bump    bumpKind
+	}{
+		{
+			name:    "feature",
+			message: "feat: add Baz",
+			want:    conventionalCommit{Type: "feat", Subject: "add Baz"},
+			bump:    bumpMinor,
+		},
+		{
+			name:    "scoped fix",
+			message: "fix(mod_b): handle empty input\n\nlonger description",
+			want:    conventionalCommit{Type: "fix", Scope: "mod_b", Subject: "handle empty input"},
+			bump:    bumpPatch,
+		},
+		{
+			name:    "breaking marker",
+			message: "refactor(mod_a)!: rename Foo to Bar",
+			want:    conventionalCommit{Type: "refactor", Scope: "mod_a", Subject: "rename Foo to Bar", Breaking: true},
+			bump:    bumpMajor,
+		},
+		{
+			name:    "breaking footer",
+			message: "feat: new config\n\nBREAKING CHANGE: Load now takes a context",
+			want:    conventionalCommit{Type: "feat", Subject: "new config", Breaking: true},
+			bump:    bumpMajor,
+		},
+		{
+			name:    "breaking footer with hyphen",
+			message: "fix: x\n\nReviewed-by: someone\nBREAKING-CHANGE: y",
+			want:    conventionalCommit{Type: "fix", Subject: "x", Breaking: true},
+			bump:    bumpMajor,
+		},
+		{
+			name:    "breaking change mentioned in the body is not a footer",
+			message: "docs: explain\n\nthis is not a BREAKING CHANGE: really",
+			want:    conventionalCommit{Type: "docs", Subject: "explain"},
+			bump:    bumpNone,
+		},
+		{
+			name:    "chore",
+			message: "chore: bump deps",
+			want:    conventionalCommit{Type: "chore", Subject: "bump deps"},
+			bump:    bumpNone,
+		},
+		{
+			name:    "not conventional",
+			message: "Fix the thing",
+			want:    conventionalCommit{Subject: "Fix the thing"},
+			bump:    bumpNone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseConventionalCommit(tt.message)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.bump, got.bump())
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+)
+
+// bazelFiles are the names of files that only mean something to Bazel. They
+// are never part of a module archive: a consumer building with Bazel gets
+// BUILD files generated for the module instead.
+var bazelFiles = map[string]bool{
+	"BUILD":           true,
+	"BUILD.bazel":     true,
+	"MODULE.bazel":    true,
+	"REPO.bazel":      true,
+	"WORKSPACE":       true,
+	"WORKSPACE.bazel": true,
+	".bazelignore":    true,
+	".bazelrc":        true,
+	".bazelversion":   true,
+}
+
+func isBazelFile(rel string) bool {
+	name := path.Base(rel)
+	return bazelFiles[name] || path.Ext(name) == ".bzl"
+}
+
+// excludeSrcs drops Bazel files, and the sources whose module relative path,
+// or one of its parent directories, matches one of the path.Match patterns,
+// so "testdata" leaves out the whole directory and "*_test.go" only top level
+// tests.
+func excludeSrcs(srcs []string, stripPrefix string, patterns []string) ([]string, error) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", p, err)
+		}
+	}
+
+	var kept []string
+	for _, src := range srcs {
+		rel := filepath.ToSlash(stripPathPrefix(src, stripPrefix))
+		if !isBazelFile(rel) && !excluded(rel, patterns) {
+			kept = append(kept, src)
+		}
+	}
+	return kept, nil
+}
+
+func excluded(rel string, patterns []string) bool {
+	for dir := rel; dir != "." && dir != "/" && dir != ""; dir = path.Dir(dir) {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExcludeSrcs(t *testing.T) {
+	srcs := []string{
+		"mod/BUILD.bazel",
+		"mod/go.sum",
+		"mod/lib.go",
+		"mod/lib_test.go",
+		"mod/testdata/golden.txt",
+		"mod/internal/testdata/deep/golden.txt",
+		"mod/internal/impl.go",
+		"mod/internal/impl_test.go",
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{
+			name: "bazel files are always dropped",
+			want: srcs[1:],
+		},
+		{
+			name:     "a directory excludes everything below it",
+			patterns: []string{"testdata"},
+			want: []string{
+				"mod/go.sum",
+				"mod/lib.go",
+				"mod/lib_test.go",
+				"mod/internal/testdata/deep/golden.txt",
+				"mod/internal/impl.go",
+				"mod/internal/impl_test.go",
+			},
+		},
+		{
+			name:     "globs match a single path element",
+			patterns: []string{"*_test.go", "*/testdata"},
+			want: []string{
+				"mod/go.sum",
+				"mod/lib.go",
+				"mod/testdata/golden.txt",
+				"mod/internal/impl.go",
+				"mod/internal/impl_test.go",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := excludeSrcs(srcs, "mod", tt.patterns)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := excludeSrcs(srcs, "mod", []string{"[testdata"})
+		assert.ErrorContains(t, err, `invalid exclude pattern "[testdata"`)
+	})
+}
@@ -5,6 +5,7 @@ go 1.23.3
 require (
 	github.com/spf13/cobra v1.8.0
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/mod v0.20.0
 )
 
 require (
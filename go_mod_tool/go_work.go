@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+type SyncGoWorkConfig struct {
+	RepoRoot string
+	GoWork   string
+	Check    bool
+}
+
+// moduleFilesExcludeDirective is the module_files gazelle directive leaving
+// files out of the _pkg_ filegroups, see gazelle_languages/module_files.
+const moduleFilesExcludeDirective = "gazelle:module_files_exclude"
+
+// runSyncGoWork makes go.work's use directives list exactly the modules of
+// the repo. Modules in a .bazelignore'd directory, or whose go.mod a
+// module_files_exclude directive leaves out, are not built by bazel and are
+// not listed. Existing use directives keep their order and comments, missing
+// ones are appended. In check mode go.work is left alone, and being out of
+// date is an error.
+func runSyncGoWork(cfg SyncGoWorkConfig, out io.Writer) error {
+	goWork := cfg.GoWork
+	if goWork == "" {
+		goWork = filepath.Join(cfg.RepoRoot, "go.work")
+	}
+
+	dirs, err := goWorkModuleDirs(cfg.RepoRoot)
+	if err != nil {
+		return fmt.Errorf("failed to find modules in %s: %w", cfg.RepoRoot, err)
+	}
+
+	data, err := os.ReadFile(goWork)
+	if err != nil {
+		return err
+	}
+	wf, err := modfile.ParseWork(goWork, data, nil)
+	if err != nil {
+		return err
+	}
+
+	changes, err := syncUses(wf, dirs)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		fmt.Fprintln(out, c)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if cfg.Check {
+		return fmt.Errorf("%s is out of date, run go_mod_tool sync-go-work", goWork)
+	}
+
+	wf.Cleanup()
+	return os.WriteFile(goWork, modfile.Format(wf.Syntax), 0644)
+}
+
+// syncUses adds and drops use directives of wf until it uses exactly dirs,
+// and describes each change: "+ <dir>" for added and "- <dir>" for dropped.
+func syncUses(wf *modfile.WorkFile, dirs []string) ([]string, error) {
+	want := map[string]bool{}
+	for _, dir := range dirs {
+		want[dir] = true
+	}
+
+	var changes []string
+	used := map[string]bool{}
+	for _, u := range append([]*modfile.Use(nil), wf.Use...) {
+		// DropUse clears the directive
+		p := u.Path
+		dir := useDir(p)
+		if want[dir] && !used[dir] {
+			used[dir] = true
+			continue
+		}
+		if err := wf.DropUse(p); err != nil {
+			return nil, err
+		}
+		changes = append(changes, "- "+p)
+	}
+	for _, dir := range dirs {
+		if used[dir] {
+			continue
+		}
+		diskPath := "./" + dir
+		if dir == "." {
+			diskPath = "."
+		}
+		if err := wf.AddUse(diskPath, ""); err != nil {
+			return nil, err
+		}
+		changes = append(changes, "+ "+diskPath)
+	}
+	return changes, nil
+}
+
+// useDir returns the slash separated directory of a use directive relative
+// to go.work, "." for the directory of go.work itself.
+func useDir(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}
+
+// goWorkModuleDirs returns the directories of the modules go.work should use,
+// sorted.
+func goWorkModuleDirs(repoRoot string) ([]string, error) {
+	modules, err := findRepoModules(repoRoot, defaultGoModTarget)
+	if err != nil {
+		return nil, err
+	}
+	ignored, err := readBazelIgnore(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, m := range modules {
+		if isBazelIgnored(ignored, m.Dir) {
+			continue
+		}
+		excluded, err := goModExcluded(repoRoot, m.Dir)
+		if err != nil {
+			return nil, err
+		}
+		if !excluded {
+			dirs = append(dirs, m.Dir)
+		}
+	}
+	return dirs, nil
+}
+
+// readBazelIgnore returns the directories listed in the .bazelignore of
+// repoRoot, if there is one.
+func readBazelIgnore(repoRoot string) ([]string, error) {
+	f, err := os.Open(filepath.Join(repoRoot, ".bazelignore"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var dirs []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dirs = append(dirs, useDir(strings.TrimPrefix(line, "/")))
+	}
+	return dirs, s.Err()
+}
+
+func isBazelIgnored(ignored []string, dir string) bool {
+	for _, d := range ignored {
+		if dir == d || strings.HasPrefix(dir, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// goModExcluded reports whether a module_files_exclude directive in the
+// build file of dir, or of any directory above it, matches go.mod. Like the
+// module_files extension, patterns are matched against file names.
+func goModExcluded(repoRoot, dir string) (bool, error) {
+	patterns, err := inheritedDirectives(repoRoot, dir, moduleFilesExcludeDirective)
+	if err != nil {
+		return false, err
+	}
+	for _, pat := range patterns {
+		if matched, _ := filepath.Match(pat, "go.mod"); matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
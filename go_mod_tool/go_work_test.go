@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoWorkModuleDirs(t *testing.T) {
+	root := writeRepoFiles(t, map[string]string{
+		".bazelignore":                "# generated\n/ignored\n\nother/ignored\n",
+		"mod_a/go.mod":                "module example.com/repo/mod_a\n",
+		"mod_a/nested/go.mod":         "module example.com/repo/mod_a/nested\n",
+		"ignored/go.mod":              "module example.com/repo/ignored\n",
+		"other/ignored/deep/go.mod":   "module example.com/repo/other/ignored/deep\n",
+		"other/kept/go.mod":           "module example.com/repo/other/kept\n",
+		"examples/BUILD.bazel":        "# gazelle:module_files_exclude go.*\n",
+		"examples/one/go.mod":         "module example.com/repo/examples/one\n",
+		"docs/BUILD":                  "# gazelle:module_files_exclude *.md\n",
+		"docs/go.mod":                 "module example.com/repo/docs\n",
+		"mod_a/testdata/x/go.mod":     "module example.com/repo/testdata\n",
+		"mod_b/BUILD.bazel":           "# gazelle:module_files_exclude_other go.mod\n",
+		"mod_b/go.mod":                "module example.com/repo/mod_b\n",
+		"ignored_not_really/go.mod":   "module example.com/repo/ignored_not_really\n",
+		"examples_too/BUILD.bazel":    "",
+		"examples_too/sub/go.mod":     "module example.com/repo/examples_too/sub\n",
+		"other/ignored_nearly/go.mod": "module example.com/repo/other/ignored_nearly\n",
+	})
+
+	dirs, err := goWorkModuleDirs(root)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"docs",
+		"examples_too/sub",
+		"ignored_not_really",
+		"mod_a",
+		"mod_a/nested",
+		"mod_b",
+		"other/ignored_nearly",
+		"other/kept",
+	}, dirs)
+}
+
+func TestRunSyncGoWork(t *testing.T) {
+	files := map[string]string{
+		"go.work": `go 1.23.3
+
+use (
+	// the tool
+	./tool
+	./gone
+	./lib
+	lib
+)
+`,
+		"tool/go.mod":    "module example.com/repo/tool\n",
+		"lib/go.mod":     "module example.com/repo/lib\n",
+		"new/mod/go.mod": "module example.com/repo/new/mod\n",
+	}
+	want := `go 1.23.3
+
+use (
+	// the tool
+	./tool
+	./lib
+	./new/mod
+)
+`
+
+	t.Run("rewrites the use directives", func(t *testing.T) {
+		root := writeRepoFiles(t, files)
+		var out bytes.Buffer
+		require.NoError(t, runSyncGoWork(SyncGoWorkConfig{RepoRoot: root}, &out))
+		assert.Equal(t, "- ./gone\n- lib\n+ ./new/mod\n", out.String())
+
+		data, err := os.ReadFile(filepath.Join(root, "go.work"))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+
+		out.Reset()
+		require.NoError(t, runSyncGoWork(SyncGoWorkConfig{RepoRoot: root, Check: true}, &out))
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("check mode fails without writing", func(t *testing.T) {
+		root := writeRepoFiles(t, files)
+		var out bytes.Buffer
+		err := runSyncGoWork(SyncGoWorkConfig{RepoRoot: root, Check: true}, &out)
+		require.ErrorContains(t, err, "is out of date")
+		assert.Equal(t, "- ./gone\n- lib\n+ ./new/mod\n", out.String())
+
+		data, err := os.ReadFile(filepath.Join(root, "go.work"))
+		require.NoError(t, err)
+		assert.Equal(t, files["go.work"], string(data))
+	})
+
+	t.Run("root module and another go.work", func(t *testing.T) {
+		root := writeRepoFiles(t, map[string]string{
+			"go.mod":            "module example.com/repo\n",
+			"tools/go.work":     "go 1.23.3\n",
+			"tools/lint/go.mod": "module example.com/repo/tools/lint\n",
+		})
+		goWork := filepath.Join(root, "tools", "go.work")
+		require.NoError(t, runSyncGoWork(SyncGoWorkConfig{RepoRoot: root, GoWork: goWork}, &bytes.Buffer{}))
+
+		data, err := os.ReadFile(goWork)
+		require.NoError(t, err)
+		assert.Equal(t, "go 1.23.3\n\nuse (\n\t.\n\t./tools/lint\n)\n", string(data))
+	})
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// manifestSchemaVersion is the version of the manifest file format. Readers
+// refuse any other version rather than guessing at fields they don't know.
+const manifestSchemaVersion = 1
+
+// versionManifest records the current version of every published module:
+//
+//	{
+//	  "schema_version": 1,
+//	  "modules": [
+//	    {
+//	      "module_path": "example.com/lib",
+//	      "version": "v1.2.3",
+//	      "hash": "h1:...",
+//	      "content_hash": "h1:...",
+//	      "commit": "0123abcd...",
+//	      "published": "2024-03-20T12:00:00Z"
+//	    }
+//	  ]
+//	}
+//
+// Only module_path and version are required; the hashes, commit and
+// published are filled in once a version has actually been published.
+type versionManifest struct {
+	SchemaVersion int             `json:"schema_version"`
+	Modules       []manifestEntry `json:"modules"`
+}
+
+type manifestEntry struct {
+	Path    string `json:"module_path"`
+	Version string `json:"version"`
+	// Hash is the go.sum style h1: hash of the module zip.
+	Hash string `json:"hash,omitempty"`
+	// ContentHash is the version independent hash of the module's files,
+	// see moduleContentHash.
+	ContentHash string `json:"content_hash,omitempty"`
+	Commit      string `json:"commit,omitempty"`
+	// Published is when the version was published, in RFC 3339 format.
+	Published string `json:"published,omitempty"`
+}
+
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{7,64}$`)
+
+func readManifest(path string) (*versionManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+	}
+
+	var m versionManifest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	if m.SchemaVersion != manifestSchemaVersion {
+		return nil, fmt.Errorf("manifest %s has schema_version %d, expected %d", path, m.SchemaVersion, manifestSchemaVersion)
+	}
+	return &m, nil
+}
+
+func writeManifest(path string, m *versionManifest) error {
+	m.SchemaVersion = manifestSchemaVersion
+	m.sort()
+	return writeJSON(path, m)
+}
+
+// version returns the recorded version of modulePath.
+func (m *versionManifest) version(modulePath string) (string, bool) {
+	if e := m.entry(modulePath); e != nil {
+		return e.Version, true
+	}
+	return "", false
+}
+
+func (m *versionManifest) entry(modulePath string) *manifestEntry {
+	for i := range m.Modules {
+		if m.Modules[i].Path == modulePath {
+			return &m.Modules[i]
+		}
+	}
+	return nil
+}
+
+// setVersion records version for modulePath, adding the module if needed.
+// The hashes, commit and publish time belong to the previous version, so
+// they are cleared when the version changes.
+func (m *versionManifest) setVersion(modulePath, version string) {
+	if e := m.entry(modulePath); e != nil {
+		if e.Version != version {
+			*e = manifestEntry{Path: modulePath, Version: version}
+		}
+		return
+	}
+	m.Modules = append(m.Modules, manifestEntry{Path: modulePath, Version: version})
+}
+
+func (m *versionManifest) sort() {
+	sort.Slice(m.Modules, func(i, j int) bool { return m.Modules[i].Path < m.Modules[j].Path })
+}
+
+// validate returns every problem found in the manifest, in module order.
+func (m *versionManifest) validate() []string {
+	var problems []string
+	if m.SchemaVersion != manifestSchemaVersion {
+		problems = append(problems, fmt.Sprintf("schema_version is %d, expected %d", m.SchemaVersion, manifestSchemaVersion))
+	}
+
+	seen := map[string]int{}
+	for i, e := range m.Modules {
+		where := fmt.Sprintf("modules[%d]", i)
+		if e.Path == "" {
+			problems = append(problems, where+": module_path is empty")
+		} else {
+			where += " (" + e.Path + ")"
+			if strings.ContainsAny(e.Path, "@ \t") {
+				problems = append(problems, fmt.Sprintf("%s: invalid module_path %q", where, e.Path))
+			}
+			if first, ok := seen[e.Path]; ok {
+				problems = append(problems, fmt.Sprintf("%s: duplicate of modules[%d]", where, first))
+			}
+			seen[e.Path] = i
+		}
+		if !semver.IsValid(e.Version) || semver.Canonical(e.Version) != e.Version {
+			problems = append(problems, fmt.Sprintf("%s: version %q is not a canonical semantic version", where, e.Version))
+		}
+		if e.Hash != "" && !validHash(e.Hash) {
+			problems = append(problems, fmt.Sprintf("%s: hash %q is not an h1: hash", where, e.Hash))
+		}
+		if e.ContentHash != "" && !validHash(e.ContentHash) {
+			problems = append(problems, fmt.Sprintf("%s: content_hash %q is not an h1: hash", where, e.ContentHash))
+		}
+		if e.Commit != "" && !commitPattern.MatchString(e.Commit) {
+			problems = append(problems, fmt.Sprintf("%s: commit %q is not a hex commit id", where, e.Commit))
+		}
+		if e.Published != "" {
+			if _, err := time.Parse(time.RFC3339, e.Published); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: published %q is not an RFC 3339 time", where, e.Published))
+			}
+		}
+	}
+	return problems
+}
+
+// validHash reports whether h is a dirhash.Hash1 hash: "h1:" and a base64
+// encoded SHA-256 sum.
+func validHash(h string) bool {
+	sum, ok := strings.CutPrefix(h, "h1:")
+	if !ok {
+		return false
+	}
+	b, err := base64.StdEncoding.DecodeString(sum)
+	return err == nil && len(b) == 32
+}
+
+// mergeManifests combines manifests from left to right, so each module ends
+// up at the highest version any of them records. A version lower than one
+// already merged is a regression, and the same version with a different hash
+// or commit means two different archives claim the version; both are
+// reported as conflicts, all of them at once.
+func mergeManifests(names []string, manifests []*versionManifest) (*versionManifest, error) {
+	merged := &versionManifest{SchemaVersion: manifestSchemaVersion}
+	from := map[string]string{}
+	var conflicts []string
+
+	for i, m := range manifests {
+		for _, e := range m.Modules {
+			current := merged.entry(e.Path)
+			if current == nil {
+				merged.Modules = append(merged.Modules, e)
+				from[e.Path] = names[i]
+				continue
+			}
+
+			switch c := semver.Compare(e.Version, current.Version); {
+			case c < 0:
+				conflicts = append(conflicts, fmt.Sprintf("%s: %s in %s is lower than %s in %s", e.Path, e.Version, names[i], current.Version, from[e.Path]))
+			case c > 0:
+				*current = e
+				from[e.Path] = names[i]
+			default:
+				for _, field := range []struct{ name, a, b string }{
+					{"hash", current.Hash, e.Hash},
+					{"content_hash", current.ContentHash, e.ContentHash},
+					{"commit", current.Commit, e.Commit},
+					{"published", current.Published, e.Published},
+				} {
+					if field.a != "" && field.b != "" && field.a != field.b {
+						conflicts = append(conflicts, fmt.Sprintf("%s@%s: %s %s in %s differs from %s in %s", e.Path, e.Version, field.name, field.b, names[i], field.a, from[e.Path]))
+					}
+				}
+				// fill in whatever the earlier manifest didn't know yet
+				if current.Hash == "" {
+					current.Hash = e.Hash
+				}
+				if current.ContentHash == "" {
+					current.ContentHash = e.ContentHash
+				}
+				if current.Commit == "" {
+					current.Commit = e.Commit
+				}
+				if current.Published == "" {
+					current.Published = e.Published
+				}
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("cannot merge manifests:\n\t%s", strings.Join(conflicts, "\n\t"))
+	}
+	merged.sort()
+	return merged, nil
+}
+
+// diffManifests describes how to get from manifest a to manifest b, one line
+// per module: "+" for added, "-" for removed and "~" for changed modules.
+func diffManifests(a, b *versionManifest) []string {
+	var lines []string
+	for _, e := range a.Modules {
+		other := b.entry(e.Path)
+		switch {
+		case other == nil:
+			lines = append(lines, fmt.Sprintf("- %s %s", e.Path, e.Version))
+		case other.Version != e.Version:
+			lines = append(lines, fmt.Sprintf("~ %s %s -> %s", e.Path, e.Version, other.Version))
+		case *other != e:
+			lines = append(lines, fmt.Sprintf("~ %s %s metadata changed", e.Path, e.Version))
+		}
+	}
+	for _, e := range b.Modules {
+		if a.entry(e.Path) == nil {
+			lines = append(lines, fmt.Sprintf("+ %s %s", e.Path, e.Version))
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i][2:] < lines[j][2:] })
+	return lines
+}
+
+type ManifestShowConfig struct {
+	Format string
+}
+
+type ManifestMergeConfig struct {
+	Output string
+}
+
+func runManifestShow(cfg ManifestShowConfig, path string, out io.Writer) error {
+	m, err := readManifest(path)
+	if err != nil {
+		return err
+	}
+	m.sort()
+
+	switch cfg.Format {
+	case "text":
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for _, e := range m.Modules {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Path, e.Version, orNone(e.Commit), orNone(e.Published))
+		}
+		return tw.Flush()
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	default:
+		return fmt.Errorf("unknown format %q, expected text or json", cfg.Format)
+	}
+}
+
+// manifestProblems reads the manifest at path for validate. Unlike
+// readManifest it doesn't stop at the first unknown field or at another
+// schema_version, so every problem of the file is reported; only a file that
+// can't be read or isn't a manifest at all is a single problem.
+func manifestProblems(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var m versionManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return []string{fmt.Sprintf("not a manifest: %v", err)}
+	}
+
+	// the same JSON decoded into maps has the fields the types don't; it
+	// decoded into the types, so it decodes into maps too
+	var fields map[string]json.RawMessage
+	var entries struct {
+		Modules []map[string]json.RawMessage `json:"modules"`
+	}
+	json.Unmarshal(data, &fields)
+	json.Unmarshal(data, &entries)
+
+	var problems []string
+	for _, name := range unknownFields(fields, reflect.TypeOf(m)) {
+		problems = append(problems, fmt.Sprintf("unknown field %q", name))
+	}
+	for i, fields := range entries.Modules {
+		where := fmt.Sprintf("modules[%d]", i)
+		if p := m.Modules[i].Path; p != "" {
+			where += " (" + p + ")"
+		}
+		for _, name := range unknownFields(fields, reflect.TypeOf(manifestEntry{})) {
+			problems = append(problems, fmt.Sprintf("%s: unknown field %q", where, name))
+		}
+	}
+	return append(problems, m.validate()...)
+}
+
+// unknownFields returns the sorted names in fields that are not the JSON name
+// of a field of the struct type t.
+func unknownFields(fields map[string]json.RawMessage, t reflect.Type) []string {
+	known := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		known[name] = true
+	}
+	var unknown []string
+	for name := range fields {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+func runManifestValidate(paths []string, out io.Writer) error {
+	invalid := 0
+	for _, path := range paths {
+		problems := manifestProblems(path)
+		for _, p := range problems {
+			fmt.Fprintf(out, "%s: %s\n", path, p)
+		}
+		if len(problems) > 0 {
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d manifests are invalid", invalid, len(paths))
+	}
+	return nil
+}
+
+func runManifestMerge(cfg ManifestMergeConfig, paths []string) error {
+	manifests := make([]*versionManifest, len(paths))
+	for i, path := range paths {
+		m, err := readManifest(path)
+		if err != nil {
+			return err
+		}
+		if problems := m.validate(); len(problems) > 0 {
+			return fmt.Errorf("manifest %s is invalid: %s", path, strings.Join(problems, "; "))
+		}
+		manifests[i] = m
+	}
+
+	merged, err := mergeManifests(paths, manifests)
+	if err != nil {
+		return err
+	}
+	return writeManifest(cfg.Output, merged)
+}
+
+func runManifestDiff(a, b string, out io.Writer) error {
+	ma, err := readManifest(a)
+	if err != nil {
+		return err
+	}
+	mb, err := readManifest(b)
+	if err != nil {
+		return err
+	}
+	for _, line := range diffManifests(ma, mb) {
+		fmt.Fprintln(out, line)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testHash = "h1:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+func TestReadManifest(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"current schema", `{"schema_version": 1, "modules": [{"module_path": "example.com/lib", "version": "v1.0.0"}]}`, ""},
+		{"missing schema", `{"modules": []}`, "has schema_version 0, expected 1"},
+		{"future schema", `{"schema_version": 2, "modules": []}`, "has schema_version 2, expected 1"},
+		{"unknown field", `{"schema_version": 1, "modules": [{"module_path": "example.com/lib", "version": "v1.0.0", "sha": "x"}]}`, `unknown field "sha"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "manifest.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+			_, err := readManifest(path)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManifestSetVersion(t *testing.T) {
+	m := &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.0.0", Hash: testHash, Commit: "abcdef0"},
+	}}
+	m.setVersion("example.com/lib", "v1.0.0")
+	assert.Equal(t, testHash, m.Modules[0].Hash)
+
+	m.setVersion("example.com/lib", "v1.1.0")
+	m.setVersion("example.com/app", "v0.1.0")
+	assert.Equal(t, []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.1.0"},
+		{Path: "example.com/app", Version: "v0.1.0"},
+	}, m.Modules)
+}
+
+func TestManifestValidate(t *testing.T) {
+	m := &versionManifest{SchemaVersion: manifestSchemaVersion, Modules: []manifestEntry{
+		{Path: "example.com/ok", Version: "v1.0.0", Hash: testHash, Commit: "0123abcd", Published: "2024-03-20T12:00:00Z"},
+		{Path: "example.com/bad", Version: "1.0", Hash: "sha256:abc", Commit: "HEAD", Published: "yesterday"},
+		{Path: "example.com/ok", Version: "v1.0"},
+		{Path: "", Version: "v1.0.0"},
+	}}
+	assert.Equal(t, []string{
+		`modules[1] (example.com/bad): version "1.0" is not a canonical semantic version`,
+		`modules[1] (example.com/bad): hash "sha256:abc" is not an h1: hash`,
+		`modules[1] (example.com/bad): commit "HEAD" is not a hex commit id`,
+		`modules[1] (example.com/bad): published "yesterday" is not an RFC 3339 time`,
+		`modules[2] (example.com/ok): duplicate of modules[0]`,
+		`modules[2] (example.com/ok): version "v1.0" is not a canonical semantic version`,
+		`modules[3]: module_path is empty`,
+	}, m.validate())
+}
+
+func TestMergeManifests(t *testing.T) {
+	base := &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.2.0", Hash: testHash},
+		{Path: "example.com/app", Version: "v0.3.0"},
+		{Path: "example.com/old", Version: "v2.0.0"},
+	}}
+
+	t.Run("newer versions win", func(t *testing.T) {
+		release := &versionManifest{Modules: []manifestEntry{
+			{Path: "example.com/lib", Version: "v1.2.0", Commit: "abcdef0"},
+			{Path: "example.com/app", Version: "v0.4.0", Commit: "abcdef0"},
+			{Path: "example.com/new", Version: "v0.1.0"},
+		}}
+		merged, err := mergeManifests([]string{"base.json", "release.json"}, []*versionManifest{base, release})
+		require.NoError(t, err)
+		assert.Equal(t, manifestSchemaVersion, merged.SchemaVersion)
+		assert.Equal(t, []manifestEntry{
+			{Path: "example.com/app", Version: "v0.4.0", Commit: "abcdef0"},
+			{Path: "example.com/lib", Version: "v1.2.0", Hash: testHash, Commit: "abcdef0"},
+			{Path: "example.com/new", Version: "v0.1.0"},
+			{Path: "example.com/old", Version: "v2.0.0"},
+		}, merged.Modules)
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		release := &versionManifest{Modules: []manifestEntry{
+			{Path: "example.com/lib", Version: "v1.2.0", Hash: "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+			{Path: "example.com/old", Version: "v1.9.0"},
+		}}
+		_, err := mergeManifests([]string{"base.json", "release.json"}, []*versionManifest{base, release})
+		require.Error(t, err)
+		assert.Equal(t, `cannot merge manifests:
+	example.com/lib@v1.2.0: hash h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA= in release.json differs from `+testHash+` in base.json
+	example.com/old: v1.9.0 in release.json is lower than v2.0.0 in base.json`, err.Error())
+	})
+}
+
+func TestDiffManifests(t *testing.T) {
+	a := &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.2.0"},
+		{Path: "example.com/app", Version: "v0.3.0"},
+		{Path: "example.com/old", Version: "v2.0.0"},
+		{Path: "example.com/same", Version: "v1.0.0"},
+	}}
+	b := &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.2.0", Hash: testHash},
+		{Path: "example.com/app", Version: "v0.4.0"},
+		{Path: "example.com/new", Version: "v0.1.0"},
+		{Path: "example.com/same", Version: "v1.0.0"},
+	}}
+	assert.Equal(t, []string{
+		"~ example.com/app v0.3.0 -> v0.4.0",
+		"~ example.com/lib v1.2.0 metadata changed",
+		"+ example.com/new v0.1.0",
+		"- example.com/old v2.0.0",
+	}, diffManifests(a, b))
+}
+
+func TestRunManifestCommands(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.json")
+	release := filepath.Join(dir, "release.json")
+	merged := filepath.Join(dir, "merged.json")
+	require.NoError(t, writeManifest(base, &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.2.0", Commit: "abcdef0", Published: "2024-03-20T12:00:00Z"},
+	}}))
+	require.NoError(t, writeManifest(release, &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/app", Version: "v0.1.0"},
+	}}))
+
+	out := new(bytes.Buffer)
+	require.NoError(t, runManifestValidate([]string{base, release}, out))
+	assert.Empty(t, out.String())
+
+	require.NoError(t, runManifestMerge(ManifestMergeConfig{Output: merged}, []string{base, release}))
+
+	out.Reset()
+	require.NoError(t, runManifestShow(ManifestShowConfig{Format: "text"}, merged, out))
+	assert.Equal(t, `example.com/app  v0.1.0  (none)   (none)
+example.com/lib  v1.2.0  abcdef0  2024-03-20T12:00:00Z
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, runManifestDiff(base, merged, out))
+	assert.Equal(t, "+ example.com/app v0.1.0\n", out.String())
+
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"schema_version": 1, "modules": [{"module_path": "example.com/lib", "version": "latest"}]}`), 0644))
+	out.Reset()
+	err := runManifestValidate([]string{base, invalid}, out)
+	assert.EqualError(t, err, "1 of 2 manifests are invalid")
+	assert.Equal(t, invalid+`: modules[0] (example.com/lib): version "latest" is not a canonical semantic version`+"\n", out.String())
+
+	// validate reports what readManifest would stop at, with the other problems
+	future := filepath.Join(dir, "future.json")
+	require.NoError(t, os.WriteFile(future, []byte(`{"schema_version": 2, "source": "ci", "modules": [{"module_path": "example.com/lib", "version": "v1", "signed": true, "arch": "any"}]}`), 0644))
+	broken := filepath.Join(dir, "broken.json")
+	require.NoError(t, os.WriteFile(broken, []byte(`{"modules": [`), 0644))
+	out.Reset()
+	err = runManifestValidate([]string{future, base, broken}, out)
+	assert.EqualError(t, err, "2 of 3 manifests are invalid")
+	assert.Equal(t, future+`: unknown field "source"
+`+future+`: modules[0] (example.com/lib): unknown field "arch"
+`+future+`: modules[0] (example.com/lib): unknown field "signed"
+`+future+`: schema_version is 2, expected 1
+`+future+`: modules[0] (example.com/lib): version "v1" is not a canonical semantic version
+`+broken+`: not a manifest: unexpected end of JSON input
+`, out.String())
+}
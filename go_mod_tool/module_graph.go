@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// moduleGraph is the dependency graph between the modules of this repository,
+// built from the requires and local replaces of their go.mod files.
+type moduleGraph struct {
+	modules []*repoModule
+	// deps holds, for each module, the in-repo modules it depends on
+	deps map[*repoModule][]*repoModule
+	// dependents is deps reversed
+	dependents map[*repoModule][]*repoModule
+}
+
+func newModuleGraph(modules []*repoModule) *moduleGraph {
+	g := &moduleGraph{
+		modules:    modules,
+		deps:       map[*repoModule][]*repoModule{},
+		dependents: map[*repoModule][]*repoModule{},
+	}
+
+	byPath := map[string]*repoModule{}
+	byDir := map[string]*repoModule{}
+	for _, m := range modules {
+		byPath[m.Path] = m
+		byDir[m.Dir] = m
+	}
+
+	for _, m := range modules {
+		if m.modFile == nil {
+			continue
+		}
+		edges := map[*repoModule]bool{}
+		for _, r := range m.modFile.Require {
+			if dep, ok := byPath[r.Mod.Path]; ok {
+				edges[dep] = true
+			}
+		}
+		for _, r := range m.modFile.Replace {
+			// a replace without a version points at a directory
+			if r.New.Version != "" {
+				continue
+			}
+			if dep, ok := byDir[path.Join(m.Dir, r.New.Path)]; ok {
+				edges[dep] = true
+			}
+		}
+		delete(edges, m)
+
+		for dep := range edges {
+			g.deps[m] = append(g.deps[m], dep)
+			g.dependents[dep] = append(g.dependents[dep], m)
+		}
+	}
+	for _, m := range modules {
+		sortModules(g.deps[m])
+		sortModules(g.dependents[m])
+	}
+	return g
+}
+
+func sortModules(modules []*repoModule) {
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Path < modules[j].Path })
+}
+
+// releaseSet returns the changed modules plus every module that transitively
+// depends on one of them, ordered so each module comes after its dependencies.
+func (g *moduleGraph) releaseSet(changed []*repoModule) ([]*repoModule, error) {
+	set := map[*repoModule]bool{}
+	var visit func(m *repoModule)
+	visit = func(m *repoModule) {
+		if set[m] {
+			return
+		}
+		set[m] = true
+		for _, dependent := range g.dependents[m] {
+			visit(dependent)
+		}
+	}
+	for _, m := range changed {
+		visit(m)
+	}
+
+	var members []*repoModule
+	for m := range set {
+		members = append(members, m)
+	}
+	return g.topoSort(members)
+}
+
+// topoSort orders modules so each comes after the modules it depends on. Ties
+// are broken by module path so the order is stable.
+func (g *moduleGraph) topoSort(modules []*repoModule) ([]*repoModule, error) {
+	set := map[*repoModule]bool{}
+	for _, m := range modules {
+		set[m] = true
+	}
+
+	pending := map[*repoModule]int{}
+	for _, m := range modules {
+		for _, dep := range g.deps[m] {
+			if set[dep] {
+				pending[m]++
+			}
+		}
+	}
+
+	var ready, sorted []*repoModule
+	for _, m := range modules {
+		if pending[m] == 0 {
+			ready = append(ready, m)
+		}
+	}
+	for len(ready) > 0 {
+		sortModules(ready)
+		m := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, m)
+		for _, dependent := range g.dependents[m] {
+			if !set[dependent] {
+				continue
+			}
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(sorted) != len(modules) {
+		var cycle []string
+		for _, m := range modules {
+			if pending[m] > 0 {
+				cycle = append(cycle, m.Path)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("dependency cycle between modules (or modules depending on one): %s", strings.Join(cycle, ", "))
+	}
+	return sorted, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/modfile"
+)
+
+func testRepoModule(t *testing.T, dir, goMod string) *repoModule {
+	t.Helper()
+	mf, err := modfile.Parse(dir+"/go.mod", []byte(goMod), nil)
+	require.NoError(t, err)
+	return &repoModule{Path: mf.Module.Mod.Path, Dir: dir, modFile: mf}
+}
+
+func modulePaths(modules []*repoModule) []string {
+	paths := []string{}
+	for _, m := range modules {
+		paths = append(paths, m.Path)
+	}
+	return paths
+}
+
+func TestModuleGraph(t *testing.T) {
+	// lib <- api (require) <- app (replace only) <- tool (require), other is unrelated
+	lib := testRepoModule(t, "lib", "module example.com/lib\n")
+	api := testRepoModule(t, "api", "module example.com/api\nrequire example.com/lib v0.0.0\n")
+	app := testRepoModule(t, "cmd/app", "module example.com/app\nrequire example.com/api-renamed v0.0.0\nreplace example.com/api-renamed => ../../api\n")
+	tool := testRepoModule(t, "tool", "module example.com/tool\nrequire (\n\texample.com/app v0.0.0\n\texample.com/lib v0.0.0\n\tgithub.com/external/dep v1.0.0\n)\n")
+	other := testRepoModule(t, "other", "module example.com/other\n")
+	g := newModuleGraph([]*repoModule{tool, other, app, api, lib})
+
+	assert.Equal(t, []string{"example.com/api"}, modulePaths(g.deps[app]))
+	assert.Equal(t, []string{"example.com/app", "example.com/lib"}, modulePaths(g.deps[tool]))
+
+	tests := []struct {
+		name    string
+		changed []*repoModule
+		want    []string
+	}{
+		{"leaf", []*repoModule{tool}, []string{"example.com/tool"}},
+		{"root of the chain", []*repoModule{lib}, []string{"example.com/lib", "example.com/api", "example.com/app", "example.com/tool"}},
+		{"through a replace", []*repoModule{api}, []string{"example.com/api", "example.com/app", "example.com/tool"}},
+		{"independent modules", []*repoModule{other, app}, []string{"example.com/app", "example.com/other", "example.com/tool"}},
+		{"nothing changed", nil, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.releaseSet(tt.changed)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, modulePaths(got))
+		})
+	}
+}
+
+func TestModuleGraphCycle(t *testing.T) {
+	a := testRepoModule(t, "a", "module example.com/a\nrequire example.com/b v0.0.0\n")
+	b := testRepoModule(t, "b", "module example.com/b\nrequire example.com/a v0.0.0\n")
+	c := testRepoModule(t, "c", "module example.com/c\n")
+	g := newModuleGraph([]*repoModule{a, b, c})
+
+	_, err := g.releaseSet([]*repoModule{a})
+	assert.ErrorContains(t, err, "dependency cycle between modules (or modules depending on one): example.com/a, example.com/b")
+
+	got, err := g.releaseSet([]*repoModule{c})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com/c"}, modulePaths(got))
+}
+
+func TestRunChangedDependents(t *testing.T) {
+	out := new(bytes.Buffer)
+	err := runChanged(ChangedConfig{
+		RepoRoot:        testdata(t, "changed", "repo"),
+		ImpactedTargets: "-",
+		Format:          "text",
+		GoModTarget:     defaultGoModTarget,
+		Dependents:      true,
+	}, bytes.NewBufferString("//mod_b:lib.go\n"), out)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/repo/mod_b\nexample.com/repo/mod_a\nexample.com/repo/mod_a/nested\n", out.String())
+}
@@ -3,33 +3,96 @@ package main
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// statusKeyPattern matches the keys bazel's workspace status command can emit.
+var statusKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type statusFileOptions struct {
+	// DisallowDuplicates reports an error when a key is defined twice in the
+	// same file, rather than letting the last definition win.
+	DisallowDuplicates bool
+}
+
+// parseStatusFile parses a bazel status file (stable-status.txt or
+// volatile-status.txt). Each non-empty line is a key, a single space and a
+// value; the value may itself contain spaces, or be empty, in which case the
+// separating space may be missing too.
 func parseStatusFile(path string) (map[string]string, error) {
+	return parseStatusFileWithOptions(path, statusFileOptions{})
+}
+
+func parseStatusFileWithOptions(path string, opts statusFileOptions) (map[string]string, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read stamp file %s: %w", path, err)
 	}
 
 	result := make(map[string]string)
+	definedOn := make(map[string]int)
 	lines := strings.Split(string(content), "\n")
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
+	for i, line := range lines {
+		lineNo := i + 1
+		// only the line terminator goes, a trailing space may separate the
+		// key from an empty value
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
 			continue
 		}
 
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) != 2 {
-			continue
+		key, value, _ := strings.Cut(line, " ")
+		if !statusKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("%s:%d: invalid key %q", path, lineNo, key)
+		}
+		if previous, ok := definedOn[key]; ok && opts.DisallowDuplicates {
+			return nil, fmt.Errorf("%s:%d: duplicate key %s, first defined on line %d", path, lineNo, key, previous)
 		}
 
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		result[key] = value
+		definedOn[key] = lineNo
+		result[key] = strings.TrimSpace(value)
 	}
 
 	return result, nil
 }
+
+// readStatusFiles parses bazel's stable and volatile status files, either of
+// which may be empty (unstamped builds have neither), and merges them. A key
+// defined in both takes its value from the stable file: only stable keys
+// invalidate the action cache, so they are the ones the archive must agree with.
+func readStatusFiles(stable, volatile string, opts statusFileOptions) (map[string]string, error) {
+	result := make(map[string]string)
+
+	for _, path := range []string{volatile, stable} {
+		if path == "" {
+			continue
+		}
+		status, err := parseStatusFileWithOptions(path, opts)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range status {
+			result[key] = value
+		}
+	}
+
+	return result, nil
+}
+
+// buildTimestamp returns the time recorded in Bazel's BUILD_TIMESTAMP key,
+// which holds seconds since the epoch.
+func buildTimestamp(status map[string]string) (time.Time, bool, error) {
+	ts, ok := status["BUILD_TIMESTAMP"]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	seconds, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid BUILD_TIMESTAMP %q: %w", ts, err)
+	}
+	return time.Unix(seconds, 0).UTC(), true, nil
+}
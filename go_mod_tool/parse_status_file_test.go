@@ -71,6 +71,48 @@ BUILD_SCM_STATUS clean  `,
 			},
 			wantErr: false,
 		},
+		{
+			name:    "value with spaces",
+			content: `BUILD_USER some user name`,
+			want: map[string]string{
+				"BUILD_USER": "some user name",
+			},
+			wantErr: false,
+		},
+		{
+			name: "later duplicate wins by default",
+			content: `VOLATILE_VERSION v1.0.0
+VOLATILE_VERSION v2.0.0`,
+			want: map[string]string{
+				"VOLATILE_VERSION": "v2.0.0",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "empty values",
+			content: "BUILD_SCM_HASH abc123\nBUILD_EMBED_LABEL \r\nVOLATILE_VERSION\nBUILD_HOST",
+			want: map[string]string{
+				"BUILD_SCM_HASH":    "abc123",
+				"BUILD_EMBED_LABEL": "",
+				"VOLATILE_VERSION":  "",
+				"BUILD_HOST":        "",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "windows line endings",
+			content: "BUILD_SCM_HASH abc123\r\nBUILD_SCM_STATUS clean\r\n",
+			want: map[string]string{
+				"BUILD_SCM_HASH":   "abc123",
+				"BUILD_SCM_STATUS": "clean",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "invalid key",
+			content: `VOLATILE-VERSION v1.0.0`,
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -98,3 +140,60 @@ BUILD_SCM_STATUS clean  `,
 		assert.Error(t, err, "expected error for nonexistent file")
 	})
 }
+
+func TestParseStatusFileErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	stampFile := filepath.Join(tmpDir, "stamp.txt")
+
+	t.Run("indented line names file and line", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(stampFile, []byte("BUILD_SCM_HASH abc123\n\n VOLATILE_VERSION v1.0.0\n"), 0644))
+		_, err := parseStatusFile(stampFile)
+		assert.ErrorContains(t, err, stampFile+":3: invalid key \"\"")
+	})
+
+	t.Run("invalid key names file and line", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(stampFile, []byte("1BUILD abc123\n"), 0644))
+		_, err := parseStatusFile(stampFile)
+		assert.ErrorContains(t, err, stampFile+":1: invalid key \"1BUILD\"")
+	})
+
+	t.Run("duplicate keys rejected when requested", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(stampFile, []byte("A 1\nB 2\nA 3\n"), 0644))
+		_, err := parseStatusFileWithOptions(stampFile, statusFileOptions{DisallowDuplicates: true})
+		assert.ErrorContains(t, err, stampFile+":3: duplicate key A, first defined on line 1")
+	})
+}
+
+func TestReadStatusFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	stable := filepath.Join(tmpDir, "stable-status.txt")
+	require.NoError(t, os.WriteFile(stable, []byte("STABLE_GIT_COMMIT abc123\nSHARED stable\n"), 0644))
+	volatile := filepath.Join(tmpDir, "volatile-status.txt")
+	require.NoError(t, os.WriteFile(volatile, []byte("BUILD_TIMESTAMP 1710936000\nSHARED volatile\n"), 0644))
+
+	t.Run("stable takes precedence", func(t *testing.T) {
+		got, err := readStatusFiles(stable, volatile, statusFileOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"STABLE_GIT_COMMIT": "abc123",
+			"BUILD_TIMESTAMP":   "1710936000",
+			"SHARED":            "stable",
+		}, got)
+	})
+
+	t.Run("either file may be omitted", func(t *testing.T) {
+		got, err := readStatusFiles("", volatile, statusFileOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "volatile", got["SHARED"])
+
+		got, err = readStatusFiles("", "", statusFileOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, got)
+	})
+
+	t.Run("errors are reported", func(t *testing.T) {
+		_, err := readStatusFiles(filepath.Join(tmpDir, "nonexistent.txt"), volatile, statusFileOptions{})
+		assert.Error(t, err)
+	})
+}
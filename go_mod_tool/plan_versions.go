@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// initialVersion is proposed for modules that were never published.
+const initialVersion = "v0.1.0"
+
+type PlanVersionsConfig struct {
+	RepoRoot      string
+	Manifest      string
+	VersionSource string
+	Affected      string
+	Since         string
+	Output        string
+	GoModTarget   string
+}
+
+// versionBump is the proposed new version of one module.
+type versionBump struct {
+	Module   *repoModule
+	Previous string
+	Next     string
+	Bump     bumpKind
+	Reasons  []string
+}
+
+// nextVersion bumps previous. Pre-release versions are first released as is,
+// so v1.2.0-rc.1 bumps to v1.2.0 for a minor change. Before v1 a breaking
+// change only bumps the minor version.
+func nextVersion(previous string, bump bumpKind) (string, error) {
+	if previous == "" {
+		return initialVersion, nil
+	}
+	if !semver.IsValid(previous) {
+		return "", fmt.Errorf("previous version %q is not a semantic version", previous)
+	}
+
+	var major, minor, patch int
+	if _, err := fmt.Sscanf(semver.Canonical(previous), "v%d.%d.%d", &major, &minor, &patch); err != nil {
+		return "", fmt.Errorf("previous version %q: %w", previous, err)
+	}
+	pre := semver.Prerelease(previous) != ""
+
+	if bump == bumpMajor && major == 0 {
+		bump = bumpMinor
+	}
+
+	switch bump {
+	case bumpMajor:
+		if !(pre && minor == 0 && patch == 0) {
+			major, minor, patch = major+1, 0, 0
+		}
+	case bumpMinor:
+		if !(pre && patch == 0) {
+			minor, patch = minor+1, 0
+		}
+	default:
+		if !pre {
+			patch++
+		}
+	}
+	return fmt.Sprintf("v%d.%d.%d", major, minor, patch), nil
+}
+
+// moduleCommitMessages returns the messages of the commits after since that
+// touched m's directory, leaving out the directories of nested modules.
+func moduleCommitMessages(repoRoot string, m *repoModule, modules []*repoModule, since string) ([]string, error) {
+	args := []string{"-C", repoRoot, "log", "--format=%B%x00"}
+	if since != "" {
+		args = append(args, since+"..HEAD")
+	}
+	args = append(args, "--", m.Dir)
+	for _, other := range modules {
+		if m.contains(other) {
+			args = append(args, ":(exclude)"+other.Dir)
+		}
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log for %s failed: %w: %s", m.Path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var messages []string
+	for _, message := range strings.Split(string(out), "\x00") {
+		if message = strings.TrimSpace(message); message != "" {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// releaseBase returns the revision whose later commits decide the bump of
+// modulePath: since if given, otherwise the commit the manifest records for
+// the previous version. Without either, the module's whole history counts.
+func releaseBase(manifest *versionManifest, modulePath, previous, since string) string {
+	if since != "" {
+		return since
+	}
+	if e := manifest.entry(modulePath); e != nil && previous != "" && e.Version == previous {
+		return e.Commit
+	}
+	return ""
+}
+
+// planVersionBump decides the bump of a module from its commit messages.
+// Modules without feat, fix or breaking commits, e.g. ones released only
+// because a dependency changed, get a patch bump.
+func planVersionBump(m *repoModule, previous string, messages []string) (versionBump, error) {
+	b := versionBump{Module: m, Previous: previous, Bump: bumpPatch}
+
+	var decisive []string
+	highest := bumpNone
+	for _, message := range messages {
+		c := parseConventionalCommit(message)
+		switch bump := c.bump(); {
+		case bump > highest:
+			highest = bump
+			decisive = []string{c.Subject}
+		case bump == highest && bump != bumpNone:
+			decisive = append(decisive, c.Subject)
+		}
+	}
+	if highest != bumpNone {
+		b.Bump = highest
+		for _, subject := range decisive {
+			b.Reasons = append(b.Reasons, highest.String()+": "+subject)
+		}
+	} else if len(messages) > 0 {
+		b.Reasons = []string{"no feat, fix or breaking commits"}
+	} else {
+		b.Reasons = []string{"no commits, released for a dependency"}
+	}
+
+	if b.Bump == bumpMajor && previous != "" && semver.Major(previous) != "v0" {
+		next := fmt.Sprintf("v%d", semverMajorNumber(previous)+1)
+		return b, fmt.Errorf("%s has breaking changes (%s): releasing %s requires the module path to end in /%s", m.Path, strings.Join(b.Reasons, "; "), next, next)
+	}
+
+	next, err := nextVersion(previous, b.Bump)
+	if err != nil {
+		return b, fmt.Errorf("%s: %w", m.Path, err)
+	}
+	b.Next = next
+	return b, nil
+}
+
+func semverMajorNumber(v string) int {
+	var major int
+	fmt.Sscanf(semver.Major(v), "v%d", &major)
+	return major
+}
+
+// readAffectedModules reads the JSON written by `go_mod_tool changed --format json`
+// and resolves each entry against the modules found in the repository.
+func readAffectedModules(path string, stdin io.Reader, modules []*repoModule) ([]*repoModule, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read affected modules: %w", err)
+	}
+
+	var result changedResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse affected modules %s: %w", path, err)
+	}
+
+	byPath := map[string]*repoModule{}
+	for _, m := range modules {
+		byPath[m.Path] = m
+	}
+	var affected []*repoModule
+	for _, a := range result.Modules {
+		m, ok := byPath[a.Path]
+		if !ok {
+			return nil, fmt.Errorf("affected module %s is not in the repository", a.Path)
+		}
+		affected = append(affected, m)
+	}
+	return affected, nil
+}
+
+func runPlanVersions(cfg PlanVersionsConfig, stdin io.Reader, out io.Writer) error {
+	modules, err := findRepoModules(cfg.RepoRoot, cfg.GoModTarget)
+	if err != nil {
+		return fmt.Errorf("failed to find modules in %s: %w", cfg.RepoRoot, err)
+	}
+	affected, err := readAffectedModules(cfg.Affected, stdin, modules)
+	if err != nil {
+		return err
+	}
+
+	manifest := &versionManifest{}
+	if cfg.Manifest != "" {
+		if manifest, err = readManifest(cfg.Manifest); err != nil {
+			return err
+		}
+	}
+	var source versionSource = &manifestSource{manifest: manifest}
+	if cfg.VersionSource != "" {
+		if source, err = newVersionSource(cfg.VersionSource, cfg.GoModTarget); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range affected {
+		previous, err := latestVersion(source, m.Path)
+		if err != nil {
+			return err
+		}
+		messages, err := moduleCommitMessages(cfg.RepoRoot, m, modules, releaseBase(manifest, m.Path, previous, cfg.Since))
+		if err != nil {
+			return err
+		}
+		b, err := planVersionBump(m, previous, messages)
+		if err != nil {
+			return err
+		}
+
+		manifest.setVersion(m.Path, b.Next)
+		fmt.Fprintf(out, "%s %s -> %s (%s)\n", m.Path, orNone(b.Previous), b.Next, b.Bump)
+		for _, reason := range b.Reasons {
+			fmt.Fprintf(out, "\t%s\n", reason)
+		}
+	}
+
+	return writeManifest(cfg.Output, manifest)
+}
+
+func orNone(version string) string {
+	if version == "" {
+		return "(none)"
+	}
+	return version
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextVersion(t *testing.T) {
+	tests := []struct {
+		previous string
+		bump     bumpKind
+		want     string
+	}{
+		{"", bumpPatch, "v0.1.0"},
+		{"", bumpMajor, "v0.1.0"},
+		{"v1.2.3", bumpPatch, "v1.2.4"},
+		{"v1.2.3", bumpMinor, "v1.3.0"},
+		{"v1.2.3", bumpMajor, "v2.0.0"},
+		{"v0.2.3", bumpMajor, "v0.3.0"},
+		{"v1.2.0-rc.1", bumpPatch, "v1.2.0"},
+		{"v1.2.0-rc.1", bumpMinor, "v1.2.0"},
+		{"v1.2.1-rc.1", bumpMinor, "v1.3.0"},
+		{"v2.0.0-rc.1", bumpMajor, "v2.0.0"},
+		{"v0.1.0-1710936000", bumpPatch, "v0.1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.previous+" "+tt.bump.String(), func(t *testing.T) {
+			got, err := nextVersion(tt.previous, tt.bump)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("invalid previous version", func(t *testing.T) {
+		_, err := nextVersion("1.2.3", bumpPatch)
+		assert.ErrorContains(t, err, "not a semantic version")
+	})
+}
+
+func TestPlanVersionBump(t *testing.T) {
+	m := &repoModule{Path: "example.com/lib", Dir: "lib"}
+
+	t.Run("highest bump wins", func(t *testing.T) {
+		b, err := planVersionBump(m, "v1.0.0", []string{"fix: a", "feat: b", "chore: c", "feat(lib): d"})
+		require.NoError(t, err)
+		assert.Equal(t, bumpMinor, b.Bump)
+		assert.Equal(t, "v1.1.0", b.Next)
+		assert.Equal(t, []string{"minor: b", "minor: d"}, b.Reasons)
+	})
+
+	t.Run("dependency only release", func(t *testing.T) {
+		b, err := planVersionBump(m, "v1.0.0", nil)
+		require.NoError(t, err)
+		assert.Equal(t, "v1.0.1", b.Next)
+		assert.Equal(t, []string{"no commits, released for a dependency"}, b.Reasons)
+	})
+
+	t.Run("breaking change after v1 needs a new module path", func(t *testing.T) {
+		_, err := planVersionBump(m, "v1.4.0", []string{"feat!: drop Foo"})
+		assert.ErrorContains(t, err, "releasing v2 requires the module path to end in /v2")
+	})
+}
+
+// gitRepo creates a git repository in a temporary directory.
+func gitRepo(t *testing.T) (dir string, git func(args ...string) string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir = t.TempDir()
+	git = func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "git %s: %s", strings.Join(args, " "), out)
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	return dir, git
+}
+
+func commitFile(t *testing.T, git func(args ...string) string, dir, name, content, message string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	git("add", name)
+	git("commit", "-q", "-m", message)
+}
+
+func TestRunPlanVersions(t *testing.T) {
+	dir, git := gitRepo(t)
+
+	commitFile(t, git, dir, "lib/go.mod", "module example.com/lib\n", "chore: add lib")
+	commitFile(t, git, dir, "lib/nested/go.mod", "module example.com/lib/nested\n", "chore: add nested")
+	commitFile(t, git, dir, "app/go.mod", "module example.com/app\nrequire example.com/lib v0.0.0\nreplace example.com/lib => ../lib\n", "chore: add app")
+	base := git("rev-parse", "HEAD")
+
+	commitFile(t, git, dir, "lib/lib.go", "package lib\n", "fix(lib): handle nil")
+	commitFile(t, git, dir, "lib/nested/nested.go", "package nested\n\nfunc Gone() {}\n", "feat(nested)!: breaks nested only\n\nBREAKING CHANGE: nested API")
+	commitFile(t, git, dir, "lib/new.go", "package lib\n\nfunc New() {}\n", "feat: add New")
+
+	manifest := filepath.Join(dir, "manifest.json")
+	require.NoError(t, writeManifest(manifest, &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.2.3"},
+		{Path: "example.com/app", Version: "v0.4.0"},
+		{Path: "example.com/other", Version: "v3.0.0"},
+	}}))
+
+	affected := `{"modules": [
+		{"module_path": "example.com/lib", "dir": "lib"},
+		{"module_path": "example.com/app", "dir": "app"},
+		{"module_path": "example.com/lib/nested", "dir": "lib/nested"}
+	]}`
+
+	output := filepath.Join(dir, "new_manifest.json")
+	out := new(bytes.Buffer)
+	err := runPlanVersions(PlanVersionsConfig{
+		RepoRoot:    dir,
+		Manifest:    manifest,
+		Affected:    "-",
+		Since:       base,
+		Output:      output,
+		GoModTarget: defaultGoModTarget,
+	}, strings.NewReader(affected), out)
+	require.NoError(t, err)
+
+	assert.Equal(t, `example.com/lib v1.2.3 -> v1.3.0 (minor)
+	minor: add New
+example.com/app v0.4.0 -> v0.4.1 (patch)
+	no commits, released for a dependency
+example.com/lib/nested (none) -> v0.1.0 (major)
+	major: breaks nested only
+`, out.String())
+
+	got, err := readManifest(output)
+	require.NoError(t, err)
+	assert.Equal(t, []manifestEntry{
+		{Path: "example.com/app", Version: "v0.4.1"},
+		{Path: "example.com/lib", Version: "v1.3.0"},
+		{Path: "example.com/lib/nested", Version: "v0.1.0"},
+		{Path: "example.com/other", Version: "v3.0.0"},
+	}, got.Modules)
+}
+
+func TestRunPlanVersionsFromManifestCommit(t *testing.T) {
+	dir, git := gitRepo(t)
+
+	commitFile(t, git, dir, "lib/go.mod", "module example.com/lib\n", "chore: add lib")
+	commitFile(t, git, dir, "lib/lib.go", "package lib\n\nfunc Old() {}\n", "feat!: the v1 API\n\nBREAKING CHANGE: rewritten")
+	released := git("rev-parse", "HEAD")
+	commitFile(t, git, dir, "lib/lib.go", "package lib\n\nfunc Old() {}\n\n// fixed\n", "fix: handle nil")
+
+	manifest := filepath.Join(dir, "manifest.json")
+	require.NoError(t, writeManifest(manifest, &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.0.0", Commit: released},
+	}}))
+
+	// without --since only the commits after the recorded release count, so
+	// the breaking change released as v1.0.0 doesn't ask for a v2
+	output := filepath.Join(dir, "new_manifest.json")
+	out := new(bytes.Buffer)
+	err := runPlanVersions(PlanVersionsConfig{
+		RepoRoot:    dir,
+		Manifest:    manifest,
+		Affected:    "-",
+		Output:      output,
+		GoModTarget: defaultGoModTarget,
+	}, strings.NewReader(`{"modules": [{"module_path": "example.com/lib", "dir": "lib"}]}`), out)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/lib v1.0.0 -> v1.0.1 (patch)\n\tpatch: handle nil\n", out.String())
+
+	got, err := readManifest(output)
+	require.NoError(t, err)
+	assert.Equal(t, []manifestEntry{{Path: "example.com/lib", Version: "v1.0.1"}}, got.Modules)
+}
+
+func TestRunPlanVersionsFromGitTags(t *testing.T) {
+	dir, git := gitRepo(t)
+
+	commitFile(t, git, dir, "lib/go.mod", "module example.com/lib\n", "chore: add lib")
+	git("tag", "lib/v1.4.0")
+	commitFile(t, git, dir, "lib/lib.go", "package lib\n", "fix: handle nil")
+
+	output := filepath.Join(dir, "manifest.json")
+	out := new(bytes.Buffer)
+	err := runPlanVersions(PlanVersionsConfig{
+		RepoRoot:      dir,
+		VersionSource: "git:" + dir,
+		Affected:      "-",
+		Since:         "lib/v1.4.0",
+		Output:        output,
+		GoModTarget:   defaultGoModTarget,
+	}, strings.NewReader(`{"modules": [{"module_path": "example.com/lib", "dir": "lib"}]}`), out)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/lib v1.4.0 -> v1.4.1 (patch)\n\tpatch: handle nil\n", out.String())
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	inTotoStatementType = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType  = "https://slsa.dev/provenance/v1"
+	goModBuildType      = "https://github.com/stefanpenner/-bazel-go-mod-experiment/go_mod_tool/go_mod@v1"
+	goModBuilderID      = "https://github.com/stefanpenner/-bazel-go-mod-experiment/go_mod_tool"
+)
+
+// status keys the provenance reads its commit from, in order of preference
+var commitStatusKeys = []string{"STABLE_GIT_COMMIT", "BUILD_SCM_REVISION"}
+
+// The types below are the subset of in-toto Statement v1 and SLSA Provenance
+// v1 that go_mod_tool fills in.
+// See: https://slsa.dev/spec/v1.0/provenance
+
+type inTotoStatement struct {
+	Type          string               `json:"_type"`
+	Subject       []resourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     slsaProvenance       `json:"predicate"`
+}
+
+type resourceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+type slsaProvenance struct {
+	BuildDefinition buildDefinition `json:"buildDefinition"`
+	RunDetails      runDetails      `json:"runDetails"`
+}
+
+type buildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   externalParameters   `json:"externalParameters"`
+	InternalParameters   internalParameters   `json:"internalParameters"`
+	ResolvedDependencies []resourceDescriptor `json:"resolvedDependencies"`
+}
+
+type externalParameters struct {
+	Target     string `json:"target"`
+	ModulePath string `json:"modulePath"`
+	Version    string `json:"version"`
+}
+
+type internalParameters struct {
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+}
+
+type runDetails struct {
+	Builder  builder       `json:"builder"`
+	Metadata buildMetadata `json:"metadata"`
+}
+
+type builder struct {
+	ID string `json:"id"`
+}
+
+type buildMetadata struct {
+	StartedOn string `json:"startedOn,omitempty"`
+}
+
+// sourceDependencies describes the source files an archive was built from.
+func sourceDependencies(sources []string) ([]resourceDescriptor, error) {
+	deps := []resourceDescriptor{}
+	for _, src := range sources {
+		digest, err := sha256File(src)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, resourceDescriptor{
+			URI:    filepath.ToSlash(src),
+			Digest: map[string]string{"sha256": digest},
+		})
+	}
+	return deps, nil
+}
+
+// archiveDependencies describes a content archive stamped into a module
+// archive: the content archive itself, and each file in it under its module
+// relative path, so the source digests survive stamping.
+func archiveDependencies(zipPath string) ([]resourceDescriptor, error) {
+	zipDigest, err := sha256File(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	a, err := readModuleArchive(zipPath)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := []resourceDescriptor{{
+		URI:    filepath.ToSlash(zipPath),
+		Digest: map[string]string{"sha256": zipDigest},
+	}}
+	for _, f := range a.Files {
+		deps = append(deps, resourceDescriptor{
+			Name:   f.Path,
+			Digest: map[string]string{"sha256": f.SHA256},
+		})
+	}
+	return deps, nil
+}
+
+// buildProvenance describes how zipPath was produced from deps.
+func buildProvenance(cfg Config, version string, status map[string]string, zipPath string, deps []resourceDescriptor) (*inTotoStatement, error) {
+	zipDigest, err := sha256File(zipPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].URI != deps[j].URI {
+			return deps[i].URI < deps[j].URI
+		}
+		return deps[i].Name < deps[j].Name
+	})
+
+	var internal internalParameters
+	for _, key := range commitStatusKeys {
+		if commit, ok := status[key]; ok {
+			internal.Commit = commit
+			break
+		}
+	}
+
+	var metadata buildMetadata
+	buildTime, ok, err := buildTimestamp(status)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		internal.BuildTime = buildTime.Format(time.RFC3339)
+		metadata.StartedOn = internal.BuildTime
+	}
+
+	return &inTotoStatement{
+		Type: inTotoStatementType,
+		Subject: []resourceDescriptor{{
+			Name:   cfg.ModulePath + "@" + version + ".zip",
+			Digest: map[string]string{"sha256": zipDigest},
+		}},
+		PredicateType: slsaProvenanceType,
+		Predicate: slsaProvenance{
+			BuildDefinition: buildDefinition{
+				BuildType: goModBuildType,
+				ExternalParameters: externalParameters{
+					Target:     cfg.Label,
+					ModulePath: cfg.ModulePath,
+					Version:    version,
+				},
+				InternalParameters:   internal,
+				ResolvedDependencies: deps,
+			},
+			RunDetails: runDetails{
+				Builder:  builder{ID: goModBuilderID},
+				Metadata: metadata,
+			},
+		},
+	}, nil
+}
+
+func writeProvenance(cfg Config, version string, status map[string]string, deps []resourceDescriptor) error {
+	statement, err := buildProvenance(cfg, version, status, cfg.Output, deps)
+	if err != nil {
+		return err
+	}
+	return writeJSON(cfg.ProvenanceOutput, statement)
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteProvenance(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	goModFile := filepath.Join(tmpDir, "go.mod")
+	require.NoError(t, os.WriteFile(goModFile, []byte("module example.com/test"), 0644))
+	srcFile := filepath.Join(tmpDir, "test.go")
+	require.NoError(t, os.WriteFile(srcFile, []byte("package test"), 0644))
+
+	cfg := Config{
+		Output:           filepath.Join(tmpDir, "out.zip"),
+		ModulePath:       "example.com/test",
+		GoMod:            goModFile,
+		SrcFiles:         []string{srcFile, goModFile},
+		StripPrefix:      tmpDir,
+		Label:            "//test:go_mod_zip",
+		ProvenanceOutput: filepath.Join(tmpDir, "out.provenance.json"),
+	}
+	require.NoError(t, writeModuleZip(cfg, "example.com/test@v1.0.0"))
+
+	t.Run("with stamp data", func(t *testing.T) {
+		status := map[string]string{
+			"STABLE_GIT_COMMIT": "0123456789abcdef",
+			"BUILD_TIMESTAMP":   "1710936000",
+		}
+		deps, err := sourceDependencies(append([]string{cfg.GoMod}, archivedSrcs(cfg)...))
+		require.NoError(t, err)
+		require.NoError(t, writeProvenance(cfg, "v1.0.0", status, deps))
+
+		data, err := os.ReadFile(cfg.ProvenanceOutput)
+		require.NoError(t, err)
+		var got inTotoStatement
+		require.NoError(t, json.Unmarshal(data, &got))
+
+		zipDigest, err := sha256File(cfg.Output)
+		require.NoError(t, err)
+		goModDigest, err := sha256File(goModFile)
+		require.NoError(t, err)
+		srcDigest, err := sha256File(srcFile)
+		require.NoError(t, err)
+
+		assert.Equal(t, inTotoStatementType, got.Type)
+		assert.Equal(t, slsaProvenanceType, got.PredicateType)
+		assert.Equal(t, []resourceDescriptor{{
+			Name:   "example.com/test@v1.0.0.zip",
+			Digest: map[string]string{"sha256": zipDigest},
+		}}, got.Subject)
+
+		def := got.Predicate.BuildDefinition
+		assert.Equal(t, externalParameters{
+			Target:     "//test:go_mod_zip",
+			ModulePath: "example.com/test",
+			Version:    "v1.0.0",
+		}, def.ExternalParameters)
+		assert.Equal(t, internalParameters{
+			Commit:    "0123456789abcdef",
+			BuildTime: "2024-03-20T12:00:00Z",
+		}, def.InternalParameters)
+		// go.mod is listed once even though it is also passed as a src
+		assert.Equal(t, []resourceDescriptor{
+			{URI: filepath.ToSlash(goModFile), Digest: map[string]string{"sha256": goModDigest}},
+			{URI: filepath.ToSlash(srcFile), Digest: map[string]string{"sha256": srcDigest}},
+		}, def.ResolvedDependencies)
+		assert.Equal(t, "2024-03-20T12:00:00Z", got.Predicate.RunDetails.Metadata.StartedOn)
+	})
+
+	t.Run("falls back to BUILD_SCM_REVISION", func(t *testing.T) {
+		statement, err := buildProvenance(cfg, "v1.0.0", map[string]string{"BUILD_SCM_REVISION": "abc123"}, cfg.Output, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", statement.Predicate.BuildDefinition.InternalParameters.Commit)
+		assert.Empty(t, statement.Predicate.RunDetails.Metadata.StartedOn)
+	})
+
+	t.Run("invalid BUILD_TIMESTAMP", func(t *testing.T) {
+		_, err := buildProvenance(cfg, "v1.0.0", map[string]string{"BUILD_TIMESTAMP": "yesterday"}, cfg.Output, nil)
+		assert.ErrorContains(t, err, "BUILD_TIMESTAMP")
+	})
+}
+
+func TestStampProvenance(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(src, 0755))
+	goModFile := filepath.Join(src, "go.mod")
+	srcFile := filepath.Join(src, "lib.go")
+	require.NoError(t, os.WriteFile(goModFile, []byte("module example.com/test\n"), 0644))
+	require.NoError(t, os.WriteFile(srcFile, []byte("package lib\n"), 0644))
+
+	content := filepath.Join(tmpDir, "content.zip")
+	require.NoError(t, run(Config{
+		Output:      content,
+		ModulePath:  "example.com/test",
+		GoMod:       goModFile,
+		SrcFiles:    []string{goModFile, srcFile},
+		StripPrefix: src,
+	}))
+
+	status := filepath.Join(tmpDir, "volatile-status.txt")
+	require.NoError(t, os.WriteFile(status, []byte("VOLATILE_VERSION v1.0.0\n"), 0644))
+	provenance := filepath.Join(tmpDir, "out.provenance.json")
+	require.NoError(t, runStamp(StampConfig{
+		Input:              content,
+		Output:             filepath.Join(tmpDir, "out.zip"),
+		VolatileStatusFile: status,
+		Label:              "//test:go_mod_zip",
+		ProvenanceOutput:   provenance,
+	}))
+
+	data, err := os.ReadFile(provenance)
+	require.NoError(t, err)
+	var got inTotoStatement
+	require.NoError(t, json.Unmarshal(data, &got))
+
+	contentDigest, err := sha256File(content)
+	require.NoError(t, err)
+	goModDigest, err := sha256File(goModFile)
+	require.NoError(t, err)
+	srcDigest, err := sha256File(srcFile)
+	require.NoError(t, err)
+
+	// the sources keep their digests through the content archive
+	assert.Equal(t, []resourceDescriptor{
+		{Name: "go.mod", Digest: map[string]string{"sha256": goModDigest}},
+		{Name: "lib.go", Digest: map[string]string{"sha256": srcDigest}},
+		{URI: filepath.ToSlash(content), Digest: map[string]string{"sha256": contentDigest}},
+	}, got.Predicate.BuildDefinition.ResolvedDependencies)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// A local proxy directory uses the GOPROXY protocol layout, so it can be
+// served as is or used with GOPROXY=file:///path:
+//
+//	<dir>/<escaped module path>/@v/list
+//	<dir>/<escaped module path>/@v/<version>.{info,mod,zip}
+
+// proxyModuleDir returns the @v directory of modulePath inside a proxy directory.
+func proxyModuleDir(dir, modulePath string) (string, error) {
+	escaped, err := module.EscapePath(modulePath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.FromSlash(escaped), "@v"), nil
+}
+
+// proxyFile returns the path of a version's .info, .mod or .zip file.
+func proxyFile(dir, modulePath, version, ext string) (string, error) {
+	vdir, err := proxyModuleDir(dir, modulePath)
+	if err != nil {
+		return "", err
+	}
+	escaped, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(vdir, escaped+ext), nil
+}
+
+// proxyVersions lists the versions of modulePath that have a .zip in the
+// proxy directory, sorted by semver. A missing module has no versions.
+func proxyVersions(dir, modulePath string) ([]string, error) {
+	vdir, err := proxyModuleDir(dir, modulePath)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(vdir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".zip")
+		if !ok {
+			continue
+		}
+		v, err := module.UnescapeVersion(name)
+		if err != nil || !semver.IsValid(v) {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	semver.Sort(versions)
+	return versions, nil
+}
+
+// latestVersionBefore returns the highest release lower than version, or ""
+// when there is none. Prereleases are skipped: they promise no compatibility.
+func latestVersionBefore(versions []string, version string) string {
+	latest := ""
+	for _, v := range versions {
+		if semver.Prerelease(v) == "" && semver.Compare(v, version) < 0 && (latest == "" || semver.Compare(v, latest) > 0) {
+			latest = v
+		}
+	}
+	return latest
+}
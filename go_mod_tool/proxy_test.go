@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyVersions(t *testing.T) {
+	dir := t.TempDir()
+	vdir := filepath.Join(dir, "example.com", "!my!mod", "@v")
+	require.NoError(t, os.MkdirAll(vdir, 0755))
+	for _, name := range []string{"v1.10.0.zip", "v1.2.0.zip", "v1.2.0.mod", "v1.3.0-rc.1.zip", "list", "junk.zip"} {
+		require.NoError(t, os.WriteFile(filepath.Join(vdir, name), nil, 0644))
+	}
+
+	versions, err := proxyVersions(dir, "example.com/MyMod")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.2.0", "v1.3.0-rc.1", "v1.10.0"}, versions)
+
+	zipPath, err := proxyFile(dir, "example.com/MyMod", "v1.2.0", ".zip")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(vdir, "v1.2.0.zip"), zipPath)
+
+	versions, err = proxyVersions(dir, "example.com/unpublished")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+}
+
+func TestLatestVersionBefore(t *testing.T) {
+	versions := []string{"v1.0.0", "v1.1.0", "v1.2.0-rc.1", "v2.0.0"}
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"v1.2.0", "v1.1.0"},
+		{"v1.1.0", "v1.0.0"},
+		{"v3.0.0", "v2.0.0"},
+		{"v1.0.0", ""},
+		{"v0.9.0", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			assert.Equal(t, tt.want, latestVersionBefore(versions, tt.version))
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// publisher is where released module archives go. Publishing the same
+// version twice must be detectable, so an interrupted release can resume.
+type publisher interface {
+	// Published returns the h1: hash of the archive published for
+	// modulePath@version, if that version has been published.
+	Published(modulePath, version string) (hash string, ok bool, err error)
+	// Publish makes the module archive at zipPath available as
+	// modulePath@version.
+	Publish(modulePath, version, zipPath string, published time.Time) error
+}
+
+// newPublisher creates a publisher from a "kind:location" spec:
+//
+//	dir:<path>   a local proxy directory, see proxyModuleDir
+func newPublisher(spec string) (publisher, error) {
+	kind, location, ok := strings.Cut(spec, ":")
+	if !ok || location == "" {
+		return nil, fmt.Errorf("invalid publish backend %q, expected dir:<path>", spec)
+	}
+	switch kind {
+	case "dir":
+		return &proxyDirPublisher{dir: location}, nil
+	default:
+		return nil, fmt.Errorf("unknown publish backend %q, expected dir", kind)
+	}
+}
+
+// proxyDirPublisher publishes into a local proxy directory, writing the
+// .info, .mod and .zip files and the @v/list the GOPROXY protocol serves.
+type proxyDirPublisher struct {
+	dir string
+}
+
+func (p *proxyDirPublisher) Published(modulePath, version string) (string, bool, error) {
+	zipPath, err := proxyFile(p.dir, modulePath, version, ".zip")
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := os.Stat(zipPath); os.IsNotExist(err) {
+		return "", false, nil
+	}
+	hash, err := dirhash.HashZip(zipPath, dirhash.Hash1)
+	if err != nil {
+		return "", false, err
+	}
+	return hash, true, nil
+}
+
+func (p *proxyDirPublisher) Publish(modulePath, version, zipPath string, published time.Time) error {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	mod, err := readZipFile(&zr.Reader, modulePath+"@"+version+"/go.mod")
+	zr.Close()
+	if err != nil {
+		return err
+	}
+	info, err := json.Marshal(struct {
+		Version string
+		Time    string
+	}{version, published.UTC().Format(time.RFC3339)})
+	if err != nil {
+		return err
+	}
+
+	vdir, err := proxyModuleDir(p.dir, modulePath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(vdir, 0755); err != nil {
+		return err
+	}
+
+	// the .zip goes last: its presence is what marks the version as published
+	files := []struct {
+		ext  string
+		data func(w io.Writer) error
+	}{
+		{".info", func(w io.Writer) error { _, err := w.Write(append(info, '\n')); return err }},
+		{".mod", func(w io.Writer) error { _, err := w.Write(mod); return err }},
+		{".zip", func(w io.Writer) error { return copyFileTo(w, zipPath) }},
+	}
+	for _, f := range files {
+		dst, err := proxyFile(p.dir, modulePath, version, f.ext)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(dst, f.data); err != nil {
+			return err
+		}
+	}
+
+	versions, err := proxyVersions(p.dir, modulePath)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(vdir, "list"), func(w io.Writer) error {
+		_, err := io.WriteString(w, strings.Join(versions, "\n")+"\n")
+		return err
+	})
+}
+
+// writeFileAtomic writes path through a temporary file in the same
+// directory, so readers never see a partially written file.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func copyFileTo(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
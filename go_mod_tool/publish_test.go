@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPublisher(t *testing.T) {
+	_, err := newPublisher("dir:/tmp/proxy")
+	assert.NoError(t, err)
+	_, err = newPublisher("dir:")
+	assert.ErrorContains(t, err, `invalid publish backend "dir:"`)
+	_, err = newPublisher("s3:bucket")
+	assert.ErrorContains(t, err, `unknown publish backend "s3"`)
+}
+
+func TestProxyDirPublisher(t *testing.T) {
+	tmpDir := t.TempDir()
+	proxyDir := filepath.Join(tmpDir, "proxy")
+	pub := &proxyDirPublisher{dir: proxyDir}
+
+	_, ok, err := pub.Published("example.com/lib", "v1.0.0")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	published := time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)
+	for _, version := range []string{"v1.10.0", "v1.2.0"} {
+		zipPath := filepath.Join(tmpDir, version+".zip")
+		writeTestZip(t, zipPath, map[string]string{
+			"example.com/lib@" + version + "/go.mod": "module example.com/lib\n",
+			"example.com/lib@" + version + "/lib.go": "package lib\n",
+		})
+		require.NoError(t, pub.Publish("example.com/lib", version, zipPath, published))
+	}
+
+	vdir := filepath.Join(proxyDir, "example.com", "lib", "@v")
+	list, err := os.ReadFile(filepath.Join(vdir, "list"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0\nv1.10.0\n", string(list))
+
+	mod, err := os.ReadFile(filepath.Join(vdir, "v1.2.0.mod"))
+	require.NoError(t, err)
+	assert.Equal(t, "module example.com/lib\n", string(mod))
+
+	info, err := os.ReadFile(filepath.Join(vdir, "v1.2.0.info"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Version": "v1.2.0", "Time": "2024-03-20T12:00:00Z"}`, string(info))
+
+	hash, ok, err := pub.Published("example.com/lib", "v1.2.0")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	want, err := hashArchive(filepath.Join(tmpDir, "v1.2.0.zip"), "")
+	require.NoError(t, err)
+	assert.Equal(t, want.ZipHash, hash)
+}
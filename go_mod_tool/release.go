@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// releasePlanSchemaVersion is the version of the plan file format.
+const releasePlanSchemaVersion = 1
+
+type PlanConfig struct {
+	RepoRoot        string
+	ImpactedTargets string
+	ChangedFiles    string
+	GoModTarget     string
+	Manifest        string
+	VersionSource   string
+	Since           string
+	Archives        map[string]string
+	ArchivesFile    string
+	Output          string
+	ManifestOutput  string
+}
+
+type ApplyConfig struct {
+	Plan          string
+	Backend       string
+	Progress      string
+	Manifest      string
+	VersionSource string
+	GoModTarget   string
+}
+
+// releasePlan is the reviewable output of `go_mod_tool plan`: every module to
+// release, in an order where dependencies come before their dependents, and
+// the affected modules whose content didn't change since their last release.
+type releasePlan struct {
+	SchemaVersion int              `json:"schema_version"`
+	Commit        string           `json:"commit"`
+	Releases      []plannedRelease `json:"releases"`
+	Unchanged     []manifestEntry  `json:"unchanged,omitempty"`
+}
+
+type plannedRelease struct {
+	Path        string   `json:"module_path"`
+	Dir         string   `json:"dir"`
+	Previous    string   `json:"previous_version,omitempty"`
+	Version     string   `json:"version"`
+	Bump        string   `json:"bump"`
+	Reasons     []string `json:"reasons"`
+	ContentHash string   `json:"content_hash"`
+	Archive     string   `json:"archive,omitempty"`
+}
+
+// releaseProgress records which planned releases `go_mod_tool apply` has
+// published, so an interrupted run can resume where it stopped.
+type releaseProgress struct {
+	Commit    string          `json:"commit"`
+	Published []manifestEntry `json:"published"`
+}
+
+func (p *releaseProgress) done(modulePath, version string) bool {
+	for _, e := range p.Published {
+		if e.Path == modulePath && e.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func readReleasePlan(path string) (*releasePlan, error) {
+	var plan releasePlan
+	if err := readJSONFile(path, &plan); err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	if plan.SchemaVersion != releasePlanSchemaVersion {
+		return nil, fmt.Errorf("plan %s has schema_version %d, expected %d", path, plan.SchemaVersion, releasePlanSchemaVersion)
+	}
+	return &plan, nil
+}
+
+func gitHead(repoRoot string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "-C", repoRoot, "rev-parse", "HEAD")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse HEAD failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// runPlan runs the publishing algorithm from the README up to the new
+// manifest: it maps the changes to modules, adds their dependents, and
+// proposes a version for each from its commits. Modules whose content hash
+// matches the one the manifest records for their current version, and that
+// depend on no released module, are skipped: releasing them again would only
+// publish the same files under a new version.
+func runPlan(cfg PlanConfig, stdin io.Reader, out io.Writer) error {
+	targets, files, err := readChanges(cfg.ImpactedTargets, cfg.ChangedFiles, stdin)
+	if err != nil {
+		return err
+	}
+	modules, err := findRepoModules(cfg.RepoRoot, cfg.GoModTarget)
+	if err != nil {
+		return fmt.Errorf("failed to find modules in %s: %w", cfg.RepoRoot, err)
+	}
+	graph := newModuleGraph(modules)
+	releases, err := graph.releaseSet(affectedModules(modules, targets, files))
+	if err != nil {
+		return err
+	}
+
+	manifest := &versionManifest{}
+	if cfg.Manifest != "" {
+		if manifest, err = readManifest(cfg.Manifest); err != nil {
+			return err
+		}
+	}
+	var source versionSource = &manifestSource{manifest: manifest}
+	if cfg.VersionSource != "" {
+		if source, err = newVersionSource(cfg.VersionSource, cfg.GoModTarget); err != nil {
+			return err
+		}
+	}
+
+	// archives built by bazel, see `go_mod_tool archives`; --archive wins
+	archives := map[string]string{}
+	if cfg.ArchivesFile != "" {
+		if archives, err = readArchivesFile(cfg.ArchivesFile); err != nil {
+			return err
+		}
+	}
+	for modulePath, zip := range cfg.Archives {
+		archives[modulePath] = zip
+	}
+
+	commit, err := gitHead(cfg.RepoRoot)
+	if err != nil {
+		return err
+	}
+	plan := &releasePlan{SchemaVersion: releasePlanSchemaVersion, Commit: commit, Releases: []plannedRelease{}}
+
+	for _, m := range releases {
+		previous, err := latestVersion(source, m.Path)
+		if err != nil {
+			return err
+		}
+		contentHash, err := moduleContentHash(cfg.RepoRoot, m, modules)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", m.Path, err)
+		}
+		// a dependent of a released module is released again for the new
+		// require, even when its own files didn't change
+		if e := manifest.entry(m.Path); e != nil && previous != "" && e.Version == previous && e.ContentHash == contentHash && !dependsOnRelease(plan, graph.deps[m]) {
+			plan.Unchanged = append(plan.Unchanged, manifestEntry{Path: m.Path, Version: previous, ContentHash: contentHash})
+			fmt.Fprintf(out, "%s %s unchanged (content %s), skipping\n", m.Path, previous, contentHash)
+			continue
+		}
+
+		messages, err := moduleCommitMessages(cfg.RepoRoot, m, modules, releaseBase(manifest, m.Path, previous, cfg.Since))
+		if err != nil {
+			return err
+		}
+		b, err := planVersionBump(m, previous, messages)
+		if err != nil {
+			return err
+		}
+
+		plan.Releases = append(plan.Releases, plannedRelease{
+			Path:        m.Path,
+			Dir:         m.Dir,
+			Previous:    previous,
+			Version:     b.Next,
+			Bump:        b.Bump.String(),
+			Reasons:     b.Reasons,
+			ContentHash: contentHash,
+			Archive:     archives[m.Path],
+		})
+		manifest.setVersion(m.Path, b.Next)
+		fmt.Fprintf(out, "%s %s -> %s (%s)\n", m.Path, orNone(previous), b.Next, b.Bump)
+	}
+
+	for modulePath := range cfg.Archives {
+		if !planned(plan, modulePath) {
+			return fmt.Errorf("--archive given for %s, which has nothing to release", modulePath)
+		}
+	}
+
+	if err := writeJSON(cfg.Output, plan); err != nil {
+		return err
+	}
+	if cfg.ManifestOutput != "" {
+		return writeManifest(cfg.ManifestOutput, manifest)
+	}
+	return nil
+}
+
+// dependsOnRelease reports whether one of deps is released by plan.
+func dependsOnRelease(plan *releasePlan, deps []*repoModule) bool {
+	for _, dep := range deps {
+		if planned(plan, dep.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+func planned(plan *releasePlan, modulePath string) bool {
+	for _, r := range plan.Releases {
+		if r.Path == modulePath {
+			return true
+		}
+	}
+	return false
+}
+
+// runApply publishes every release of a plan in order. Progress is saved
+// after each module; on a rerun, releases already recorded there, or already
+// present in the backend with the same archive hash, are not published again.
+// With a version source, a version it lists that the backend doesn't have was
+// published elsewhere, and is refused rather than published a second time.
+func runApply(cfg ApplyConfig, out io.Writer) error {
+	plan, err := readReleasePlan(cfg.Plan)
+	if err != nil {
+		return err
+	}
+	pub, err := newPublisher(cfg.Backend)
+	if err != nil {
+		return err
+	}
+	var source versionSource
+	if cfg.VersionSource != "" {
+		if source, err = newVersionSource(cfg.VersionSource, cfg.GoModTarget); err != nil {
+			return err
+		}
+	}
+
+	progressPath := cfg.Progress
+	if progressPath == "" {
+		progressPath = cfg.Plan + ".progress"
+	}
+	progress := &releaseProgress{Commit: plan.Commit, Published: []manifestEntry{}}
+	if err := readJSONFile(progressPath, progress); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read progress: %w", err)
+	}
+	if progress.Commit != plan.Commit {
+		return fmt.Errorf("%s records a release of commit %s, but the plan is for %s", progressPath, progress.Commit, plan.Commit)
+	}
+
+	for _, r := range plan.Releases {
+		if progress.done(r.Path, r.Version) {
+			fmt.Fprintf(out, "%s@%s: already published\n", r.Path, r.Version)
+			continue
+		}
+		entry, err := publishRelease(pub, source, plan, r, out)
+		if err != nil {
+			return err
+		}
+		progress.Published = append(progress.Published, entry)
+		if err := writeJSON(progressPath, progress); err != nil {
+			return fmt.Errorf("failed to record progress: %w", err)
+		}
+	}
+
+	if cfg.Manifest == "" {
+		return nil
+	}
+	manifest, err := readManifest(cfg.Manifest)
+	if err != nil {
+		return err
+	}
+	for _, e := range progress.Published {
+		manifest.setVersion(e.Path, e.Version)
+		*manifest.entry(e.Path) = e
+	}
+	return writeManifest(cfg.Manifest, manifest)
+}
+
+// publishRelease publishes the archive of a single planned release, after
+// checking the archive is the one the plan is about. source may be nil.
+func publishRelease(pub publisher, source versionSource, plan *releasePlan, r plannedRelease, out io.Writer) (manifestEntry, error) {
+	entry := manifestEntry{Path: r.Path, Version: r.Version, ContentHash: r.ContentHash, Commit: plan.Commit}
+	if r.Archive == "" {
+		return entry, fmt.Errorf("%s@%s: the plan has no archive for it", r.Path, r.Version)
+	}
+
+	h, err := hashArchive(r.Archive, "")
+	if err != nil {
+		return entry, fmt.Errorf("%s: %w", r.Archive, err)
+	}
+	if h.ModulePath != r.Path || h.Version != r.Version {
+		return entry, fmt.Errorf("%s contains %s@%s, but the plan releases %s@%s: rebuild it with the planned versions", r.Archive, h.ModulePath, h.Version, r.Path, r.Version)
+	}
+	entry.Hash = h.ZipHash
+
+	existing, ok, err := pub.Published(r.Path, r.Version)
+	if err != nil {
+		return entry, err
+	}
+	now := time.Now().UTC()
+	switch {
+	case ok && existing != h.ZipHash:
+		return entry, fmt.Errorf("%s@%s is already published with hash %s, refusing to replace it with %s", r.Path, r.Version, existing, h.ZipHash)
+	case ok:
+		fmt.Fprintf(out, "%s@%s: already published by an earlier run\n", r.Path, r.Version)
+	default:
+		if source != nil {
+			versions, err := source.Versions(r.Path)
+			if err != nil {
+				return entry, fmt.Errorf("failed to list versions of %s: %w", r.Path, err)
+			}
+			if slices.Contains(versions, r.Version) {
+				return entry, fmt.Errorf("%s@%s is already published according to the version source, but not to the backend: refusing to publish it again", r.Path, r.Version)
+			}
+		}
+		if err := pub.Publish(r.Path, r.Version, r.Archive, now); err != nil {
+			return entry, fmt.Errorf("failed to publish %s@%s: %w", r.Path, r.Version, err)
+		}
+		fmt.Fprintf(out, "%s@%s: published\n", r.Path, r.Version)
+	}
+	entry.Published = now.Format(time.RFC3339)
+	return entry, nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPlanAndApply(t *testing.T) {
+	dir, git := gitRepo(t)
+
+	commitFile(t, git, dir, "lib/go.mod", "module example.com/lib\n", "chore: add lib")
+	commitFile(t, git, dir, "app/go.mod", "module example.com/app\nrequire example.com/lib v0.0.0\nreplace example.com/lib => ../lib\n", "chore: add app")
+	commitFile(t, git, dir, "other/go.mod", "module example.com/other\n", "chore: add other")
+	base := git("rev-parse", "HEAD")
+	commitFile(t, git, dir, "lib/lib.go", "package lib\n\nfunc New() {}\n", "feat(lib): add New")
+	head := git("rev-parse", "HEAD")
+
+	work := t.TempDir()
+	manifest := filepath.Join(work, "manifest.json")
+	require.NoError(t, writeManifest(manifest, &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.2.3"},
+		{Path: "example.com/app", Version: "v0.4.0"},
+		{Path: "example.com/other", Version: "v3.0.0"},
+	}}))
+
+	libZip := filepath.Join(work, "lib.zip")
+	writeTestZip(t, libZip, map[string]string{
+		"example.com/lib@v1.3.0/go.mod": "module example.com/lib\n",
+		"example.com/lib@v1.3.0/lib.go": "package lib\n\nfunc New() {}\n",
+	})
+	appZip := filepath.Join(work, "app.zip")
+	writeTestZip(t, appZip, map[string]string{
+		"example.com/app@v0.4.1/go.mod": "module example.com/app\n",
+	})
+
+	planPath := filepath.Join(work, "plan.json")
+	newManifest := filepath.Join(work, "new_manifest.json")
+	out := new(bytes.Buffer)
+	err := runPlan(PlanConfig{
+		RepoRoot:       dir,
+		ChangedFiles:   "-",
+		GoModTarget:    defaultGoModTarget,
+		Manifest:       manifest,
+		Since:          base,
+		Archives:       map[string]string{"example.com/lib": libZip, "example.com/app": appZip},
+		Output:         planPath,
+		ManifestOutput: newManifest,
+	}, strings.NewReader("lib/lib.go\n"), out)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/lib v1.2.3 -> v1.3.0 (minor)\nexample.com/app v0.4.0 -> v0.4.1 (patch)\n", out.String())
+
+	plan, err := readReleasePlan(planPath)
+	require.NoError(t, err)
+	assert.Equal(t, &releasePlan{
+		SchemaVersion: releasePlanSchemaVersion,
+		Commit:        head,
+		Releases: []plannedRelease{
+			{Path: "example.com/lib", Dir: "lib", Previous: "v1.2.3", Version: "v1.3.0", Bump: "minor", Reasons: []string{"minor: add New"}, ContentHash: contentHashOf(t, dir, "lib"), Archive: libZip},
+			{Path: "example.com/app", Dir: "app", Previous: "v0.4.0", Version: "v0.4.1", Bump: "patch", Reasons: []string{"no commits, released for a dependency"}, ContentHash: contentHashOf(t, dir, "app"), Archive: appZip},
+		},
+	}, plan)
+
+	planned, err := readManifest(newManifest)
+	require.NoError(t, err)
+	assert.Equal(t, []manifestEntry{
+		{Path: "example.com/app", Version: "v0.4.1"},
+		{Path: "example.com/lib", Version: "v1.3.0"},
+		{Path: "example.com/other", Version: "v3.0.0"},
+	}, planned.Modules)
+
+	proxyDir := filepath.Join(work, "proxy")
+	apply := ApplyConfig{Plan: planPath, Backend: "dir:" + proxyDir, Manifest: newManifest}
+
+	// an earlier run published lib but was interrupted before recording it
+	require.NoError(t, (&proxyDirPublisher{dir: proxyDir}).Publish("example.com/lib", "v1.3.0", libZip, time.Now()))
+
+	out.Reset()
+	require.NoError(t, runApply(apply, out))
+	assert.Equal(t, "example.com/lib@v1.3.0: already published by an earlier run\nexample.com/app@v0.4.1: published\n", out.String())
+
+	out.Reset()
+	require.NoError(t, runApply(apply, out))
+	assert.Equal(t, "example.com/lib@v1.3.0: already published\nexample.com/app@v0.4.1: already published\n", out.String())
+
+	released, err := readManifest(newManifest)
+	require.NoError(t, err)
+	require.Len(t, released.Modules, 3)
+	for _, e := range released.Modules[:2] {
+		assert.Equal(t, head, e.Commit)
+		assert.True(t, validHash(e.Hash), e.Hash)
+		assert.True(t, validHash(e.ContentHash), e.ContentHash)
+		assert.NotEmpty(t, e.Published)
+	}
+	assert.Equal(t, manifestEntry{Path: "example.com/other", Version: "v3.0.0"}, released.Modules[2])
+	assert.Empty(t, released.validate())
+}
+
+func TestRunPlanFromManifestCommit(t *testing.T) {
+	dir, git := gitRepo(t)
+
+	commitFile(t, git, dir, "lib/go.mod", "module example.com/lib\n", "chore: add lib")
+	commitFile(t, git, dir, "lib/lib.go", "package lib\n\nfunc Old() {}\n", "feat!: the v1 API\n\nBREAKING CHANGE: rewritten")
+	released := git("rev-parse", "HEAD")
+	commitFile(t, git, dir, "lib/lib.go", "package lib\n\nfunc Old() {}\n\n// fixed\n", "fix: handle nil")
+
+	work := t.TempDir()
+	manifest := filepath.Join(work, "manifest.json")
+	require.NoError(t, writeManifest(manifest, &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.0.0", Commit: released},
+	}}))
+
+	// without --since the plan starts from the commit apply recorded for the
+	// last release, so the breaking change already in v1.0.0 is not counted
+	out := new(bytes.Buffer)
+	err := runPlan(PlanConfig{
+		RepoRoot:     dir,
+		ChangedFiles: "-",
+		GoModTarget:  defaultGoModTarget,
+		Manifest:     manifest,
+		Output:       filepath.Join(work, "plan.json"),
+	}, strings.NewReader("lib/lib.go\n"), out)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com/lib v1.0.0 -> v1.0.1 (patch)\n", out.String())
+}
+
+func contentHashOf(t *testing.T, repoRoot, dir string) string {
+	t.Helper()
+	modules, err := findRepoModules(repoRoot, defaultGoModTarget)
+	require.NoError(t, err)
+	for _, m := range modules {
+		if m.Dir == dir {
+			h, err := moduleContentHash(repoRoot, m, modules)
+			require.NoError(t, err)
+			return h
+		}
+	}
+	t.Fatalf("no module in %s", dir)
+	return ""
+}
+
+func TestRunPlanSkipsUnchangedModules(t *testing.T) {
+	dir, git := gitRepo(t)
+	commitFile(t, git, dir, "lib/go.mod", "module example.com/lib\n", "chore: add lib")
+	commitFile(t, git, dir, "app/go.mod", "module example.com/app\nrequire example.com/lib v0.0.0\nreplace example.com/lib => ../lib\n", "chore: add app")
+	// reverted since the last release: touched, but the same content
+	commitFile(t, git, dir, "lib/lib.go", "package lib\n\nfunc Old() {}\n", "feat: add Old")
+	base := git("rev-parse", "HEAD")
+	commitFile(t, git, dir, "lib/lib.go", "package lib\n\nfunc New() {}\n", "feat: add New")
+	commitFile(t, git, dir, "lib/lib.go", "package lib\n\nfunc Old() {}\n", "revert: add New")
+
+	work := t.TempDir()
+	manifest := filepath.Join(work, "manifest.json")
+	libHash := contentHashOf(t, dir, "lib")
+	appHash := contentHashOf(t, dir, "app")
+	require.NoError(t, writeManifest(manifest, &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.2.3", ContentHash: libHash},
+		{Path: "example.com/app", Version: "v0.4.0", ContentHash: appHash},
+	}}))
+
+	planPath := filepath.Join(work, "plan.json")
+	out := new(bytes.Buffer)
+	require.NoError(t, runPlan(PlanConfig{
+		RepoRoot:     dir,
+		ChangedFiles: "-",
+		GoModTarget:  defaultGoModTarget,
+		Manifest:     manifest,
+		Since:        base,
+		Output:       planPath,
+	}, strings.NewReader("lib/lib.go\n"), out))
+	assert.Equal(t, "example.com/lib v1.2.3 unchanged (content "+libHash+"), skipping\nexample.com/app v0.4.0 unchanged (content "+appHash+"), skipping\n", out.String())
+
+	plan, err := readReleasePlan(planPath)
+	require.NoError(t, err)
+	assert.Equal(t, []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.2.3", ContentHash: libHash},
+		{Path: "example.com/app", Version: "v0.4.0", ContentHash: appHash},
+	}, plan.Unchanged)
+	assert.Empty(t, plan.Releases)
+}
+
+func TestRunPlanReleasesUnchangedDependents(t *testing.T) {
+	dir, git := gitRepo(t)
+	commitFile(t, git, dir, "lib/go.mod", "module example.com/lib\n", "chore: add lib")
+	commitFile(t, git, dir, "app/go.mod", "module example.com/app\nrequire example.com/lib v0.0.0\nreplace example.com/lib => ../lib\n", "chore: add app")
+	base := git("rev-parse", "HEAD")
+	commitFile(t, git, dir, "lib/lib.go", "package lib\n\nfunc New() {}\n", "feat: add New")
+
+	work := t.TempDir()
+	manifest := filepath.Join(work, "manifest.json")
+	appHash := contentHashOf(t, dir, "app")
+	require.NoError(t, writeManifest(manifest, &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.0.0"},
+		{Path: "example.com/app", Version: "v1.0.0", ContentHash: appHash},
+	}}))
+
+	planPath := filepath.Join(work, "plan.json")
+	out := new(bytes.Buffer)
+	require.NoError(t, runPlan(PlanConfig{
+		RepoRoot:     dir,
+		ChangedFiles: "-",
+		GoModTarget:  defaultGoModTarget,
+		Manifest:     manifest,
+		Since:        base,
+		Output:       planPath,
+	}, strings.NewReader("lib/lib.go\n"), out))
+	// app's files are as released, but it has to require the new lib
+	assert.Equal(t, "example.com/lib v1.0.0 -> v1.1.0 (minor)\nexample.com/app v1.0.0 -> v1.0.1 (patch)\n", out.String())
+
+	plan, err := readReleasePlan(planPath)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Unchanged)
+	require.Len(t, plan.Releases, 2)
+	assert.Equal(t, "example.com/app", plan.Releases[1].Path)
+	assert.Equal(t, appHash, plan.Releases[1].ContentHash)
+}
+
+func TestRunApplyRefusesMismatches(t *testing.T) {
+	work := t.TempDir()
+	proxyDir := filepath.Join(work, "proxy")
+
+	libZip := filepath.Join(work, "lib.zip")
+	writeTestZip(t, libZip, map[string]string{
+		"example.com/lib@v1.3.0/go.mod": "module example.com/lib\n",
+	})
+	otherZip := filepath.Join(work, "other.zip")
+	writeTestZip(t, otherZip, map[string]string{
+		"example.com/lib@v1.3.0/go.mod": "module example.com/lib\n",
+		"example.com/lib@v1.3.0/lib.go": "package lib\n",
+	})
+
+	tests := []struct {
+		name    string
+		release plannedRelease
+		wantErr string
+	}{
+		{"no archive", plannedRelease{Path: "example.com/lib", Version: "v1.3.0"}, "the plan has no archive for it"},
+		{"wrong version", plannedRelease{Path: "example.com/lib", Version: "v1.4.0", Archive: libZip}, "contains example.com/lib@v1.3.0, but the plan releases example.com/lib@v1.4.0"},
+		{"different content", plannedRelease{Path: "example.com/lib", Version: "v1.3.0", Archive: otherZip}, "is already published with hash"},
+	}
+	require.NoError(t, (&proxyDirPublisher{dir: proxyDir}).Publish("example.com/lib", "v1.3.0", libZip, time.Now()))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planPath := filepath.Join(t.TempDir(), "plan.json")
+			require.NoError(t, writeJSON(planPath, &releasePlan{
+				SchemaVersion: releasePlanSchemaVersion,
+				Commit:        "abcdef0",
+				Releases:      []plannedRelease{tt.release},
+			}))
+			err := runApply(ApplyConfig{Plan: planPath, Backend: "dir:" + proxyDir}, new(bytes.Buffer))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	t.Run("published according to the version source", func(t *testing.T) {
+		work := t.TempDir()
+		manifest := filepath.Join(work, "manifest.json")
+		require.NoError(t, writeManifest(manifest, &versionManifest{Modules: []manifestEntry{
+			{Path: "example.com/lib", Version: "v1.3.0"},
+		}}))
+		planPath := filepath.Join(work, "plan.json")
+		require.NoError(t, writeJSON(planPath, &releasePlan{
+			SchemaVersion: releasePlanSchemaVersion,
+			Commit:        "abcdef0",
+			Releases:      []plannedRelease{{Path: "example.com/lib", Version: "v1.3.0", Archive: libZip}},
+		}))
+
+		// a backend that doesn't have it yet
+		emptyProxy := filepath.Join(work, "proxy")
+		err := runApply(ApplyConfig{Plan: planPath, Backend: "dir:" + emptyProxy, VersionSource: "manifest:" + manifest}, new(bytes.Buffer))
+		assert.ErrorContains(t, err, "example.com/lib@v1.3.0 is already published according to the version source, but not to the backend")
+		_, ok, err := (&proxyDirPublisher{dir: emptyProxy}).Published("example.com/lib", "v1.3.0")
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		// the backend published it in an earlier run
+		out := new(bytes.Buffer)
+		require.NoError(t, runApply(ApplyConfig{Plan: planPath, Backend: "dir:" + proxyDir, VersionSource: "manifest:" + manifest}, out))
+		assert.Equal(t, "example.com/lib@v1.3.0: already published by an earlier run\n", out.String())
+	})
+
+	t.Run("progress of another commit", func(t *testing.T) {
+		planPath := filepath.Join(t.TempDir(), "plan.json")
+		require.NoError(t, writeJSON(planPath, &releasePlan{SchemaVersion: releasePlanSchemaVersion, Commit: "abcdef0"}))
+		require.NoError(t, os.WriteFile(planPath+".progress", []byte(`{"commit": "1234567", "published": []}`), 0644))
+		err := runApply(ApplyConfig{Plan: planPath, Backend: "dir:" + proxyDir}, new(bytes.Buffer))
+		assert.ErrorContains(t, err, "records a release of commit 1234567, but the plan is for abcdef0")
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// defaultGoModTarget is the name gazelle gives the go_mod rule of a module.
+const defaultGoModTarget = "go_mod_zip"
+
+// repoModule is a Go module that lives in this repository.
+type repoModule struct {
+	Path string `json:"module_path"`
+	// Dir is the module's directory relative to the repository root, "." for the root.
+	Dir   string `json:"dir"`
+	Label string `json:"label"`
+
+	modFile *modfile.File
+}
+
+// findRepoModules walks root for go.mod files. Hidden directories, bazel
+// convenience symlinks and testdata are skipped, like the go command does, and
+// so are go.mod files without a module directive, with a warning.
+func findRepoModules(root, goModTarget string) ([]*repoModule, error) {
+	var modules []*repoModule
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || strings.HasPrefix(name, "bazel-") || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "go.mod" {
+			return nil
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		mf, err := modfile.ParseLax(p, data, nil)
+		if err != nil {
+			return err
+		}
+		if mf.Module == nil {
+			// gazelle can still give it a module path with go_mod_prefix,
+			// but nothing here knows it, so one such go.mod shouldn't stop
+			// every other module from being found
+			log.Printf("warning: %s: no module directive, skipping it", p)
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		dir := filepath.ToSlash(rel)
+		modules = append(modules, &repoModule{
+			Path:    mf.Module.Mod.Path,
+			Dir:     dir,
+			Label:   moduleLabel(dir, goModTarget),
+			modFile: mf,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Dir < modules[j].Dir })
+	return modules, nil
+}
+
+func moduleLabel(dir, target string) string {
+	if dir == "." {
+		return "//:" + target
+	}
+	return "//" + dir + ":" + target
+}
+
+// moduleOwning returns the module whose directory is the closest ancestor of
+// rel (a slash separated path relative to the repository root), or nil.
+func moduleOwning(modules []*repoModule, rel string) *repoModule {
+	rel = path.Clean(strings.TrimPrefix(filepath.ToSlash(rel), "/"))
+
+	var owner *repoModule
+	depth := -1
+	for _, m := range modules {
+		switch {
+		case m.Dir == ".":
+			if depth < 0 {
+				owner, depth = m, 0
+			}
+		case rel == m.Dir || strings.HasPrefix(rel, m.Dir+"/"):
+			if len(m.Dir) > depth {
+				owner, depth = m, len(m.Dir)
+			}
+		}
+	}
+	return owner
+}
+
+// contains reports whether other is a module nested inside m's directory.
+func (m *repoModule) contains(other *repoModule) bool {
+	if other.Dir == m.Dir {
+		return false
+	}
+	return m.Dir == "." || strings.HasPrefix(other.Dir, m.Dir+"/")
+}
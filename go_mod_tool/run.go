@@ -8,18 +8,63 @@ import (
 )
 
 func run(cfg Config) error {
-	zipFile, err := os.Create(cfg.Output)
+	srcs, err := excludeSrcs(cfg.SrcFiles, cfg.StripPrefix, cfg.Exclude)
 	if err != nil {
-		return fmt.Errorf("failed to create %s: %w", cfg.Output, err)
+		return err
 	}
-	defer zipFile.Close()
+	cfg.SrcFiles = srcs
 
-	zw := zip.NewWriter(zipFile)
-	defer zw.Close()
+	status, err := readStatusFiles(cfg.StableStatusFile, cfg.VolatileStatusFile, statusFileOptions{
+		DisallowDuplicates: cfg.StrictStatus,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to parse status files: %w", err)
+	}
 
-	status, err := parseStatusFile(cfg.VolatileStatusFile)
+	version, err := resolveVersion(cfg, status)
 	if err != nil {
-		return fmt.Errorf("failed to parse status file %s: %w", cfg.VolatileStatusFile, err)
+		return err
+	}
+	moduleDir := cfg.ModulePath + "@" + version
+
+	// TODO: now look at the go.mod, and update versions based on the version set in the status file
+
+	if err := writeModuleZip(cfg, moduleDir); err != nil {
+		return err
+	}
+
+	return writeAttestations(cfg, version, status, func() ([]resourceDescriptor, error) {
+		return sourceDependencies(append([]string{cfg.GoMod}, archivedSrcs(cfg)...))
+	})
+}
+
+// writeAttestations writes whichever of the provenance and SBOMs cfg asks
+// for, describing the archive cfg.Output built from the inputs deps returns.
+// deps is only called when a provenance is asked for.
+func writeAttestations(cfg Config, version string, status map[string]string, deps func() ([]resourceDescriptor, error)) error {
+	if cfg.ProvenanceOutput != "" {
+		resolved, err := deps()
+		if err != nil {
+			return fmt.Errorf("failed to describe the inputs of %s: %w", cfg.Output, err)
+		}
+		if err := writeProvenance(cfg, version, status, resolved); err != nil {
+			return fmt.Errorf("failed to write provenance for %s: %w", cfg.Output, err)
+		}
+	}
+
+	if cfg.SPDXOutput != "" || cfg.CycloneDXOutput != "" {
+		if err := writeSBOMs(cfg, status); err != nil {
+			return fmt.Errorf("failed to write SBOM for %s: %w", cfg.Output, err)
+		}
+	}
+	return nil
+}
+
+// resolveVersion picks the module version: the expanded --version-template
+// when one is given, otherwise the VOLATILE_VERSION status key.
+func resolveVersion(cfg Config, status map[string]string) (string, error) {
+	if cfg.VersionTemplate != "" {
+		return expandVersionTemplate(cfg.VersionTemplate, status)
 	}
 
 	// TODO: rather then just 1 volatile version, we need to support multiple, one per module
@@ -28,15 +73,25 @@ func run(cfg Config) error {
 	if !has_version {
 		version = "__unversioned__"
 	}
-	moduleDir := cfg.ModulePath + "@" + version
+	return version, nil
+}
 
-	// TODO: now look at the go.mod, and update versions based on the version set in the status file
+// writeModuleZip writes go.mod and the source files into cfg.Output, rooted at
+// moduleDir. The archive is fully closed on return so it can be read back.
+func writeModuleZip(cfg Config, moduleDir string) error {
+	zipFile, err := os.Create(cfg.Output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", cfg.Output, err)
+	}
+	defer zipFile.Close()
+
+	zw := zip.NewWriter(zipFile)
 
 	if err := addFileToZip(zw, cfg.GoMod, filepath.Join(moduleDir, "go.mod")); err != nil {
 		return fmt.Errorf("failed to add go.mod to zip: %w", err)
 	}
 
-	for _, src := range cfg.SrcFiles {
+	for _, src := range archivedSrcs(cfg) {
 		relPath := stripPathPrefix(src, cfg.StripPrefix)
 		zipPath := filepath.Join(moduleDir, relPath)
 		if err := addFileToZip(zw, src, zipPath); err != nil {
@@ -44,8 +99,21 @@ func run(cfg Config) error {
 		}
 	}
 
-	if err := zw.Flush(); err != nil {
-		return fmt.Errorf("failed to flush zip: %w", err)
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to close zip: %w", err)
 	}
-	return nil
+	return zipFile.Close()
+}
+
+// archivedSrcs returns the srcs that go into the archive next to go.mod. The
+// module's go.mod is usually among the srcs too, but it is written from
+// --go-mod, and a second go.mod entry makes the go command reject the zip.
+func archivedSrcs(cfg Config) []string {
+	var srcs []string
+	for _, src := range cfg.SrcFiles {
+		if stripPathPrefix(src, cfg.StripPrefix) != "go.mod" {
+			srcs = append(srcs, src)
+		}
+	}
+	return srcs
 }
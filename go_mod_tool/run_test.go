@@ -27,6 +27,12 @@ func TestRun(t *testing.T) {
 	statusFile := filepath.Join(tmpDir, "stamp.txt")
 	require.NoError(t, os.WriteFile(statusFile, []byte(stampContent), 0644))
 
+	buildFile := filepath.Join(tmpDir, "BUILD.bazel")
+	require.NoError(t, os.WriteFile(buildFile, []byte(`go_library(name = "test")`), 0644))
+	golden := filepath.Join(tmpDir, "testdata", "golden.txt")
+	require.NoError(t, os.MkdirAll(filepath.Dir(golden), 0755))
+	require.NoError(t, os.WriteFile(golden, []byte("golden"), 0644))
+
 	tests := []struct {
 		name        string
 		cfg         Config
@@ -53,6 +59,22 @@ func TestRun(t *testing.T) {
 				"example.com/test@v1.0.0/test.go": srcContent,
 			},
 		},
+		{
+			name: "go.mod, bazel files and excluded paths are left out",
+			cfg: Config{
+				Output:             filepath.Join(tmpDir, "filtered.zip"),
+				ModulePath:         "example.com/test",
+				GoMod:              goModFile,
+				SrcFiles:           []string{goModFile, buildFile, srcFile, golden},
+				Exclude:            []string{"testdata"},
+				VolatileStatusFile: statusFile,
+				StripPrefix:        tmpDir,
+			},
+			wantFiles: []string{
+				"example.com/test@v1.0.0/go.mod",
+				"example.com/test@v1.0.0/test.go",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -101,3 +123,33 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveVersion(t *testing.T) {
+	status := map[string]string{
+		"VOLATILE_VERSION": "v0.1.0-1710936000",
+		"BUILD_NUMBER":     "7",
+	}
+
+	t.Run("defaults to VOLATILE_VERSION", func(t *testing.T) {
+		got, err := resolveVersion(Config{}, status)
+		require.NoError(t, err)
+		assert.Equal(t, "v0.1.0-1710936000", got)
+	})
+
+	t.Run("unversioned without a stamp", func(t *testing.T) {
+		got, err := resolveVersion(Config{}, map[string]string{})
+		require.NoError(t, err)
+		assert.Equal(t, "__unversioned__", got)
+	})
+
+	t.Run("template", func(t *testing.T) {
+		got, err := resolveVersion(Config{VersionTemplate: "v1.{BUILD_NUMBER}.0"}, status)
+		require.NoError(t, err)
+		assert.Equal(t, "v1.7.0", got)
+	})
+
+	t.Run("template with undefined key", func(t *testing.T) {
+		_, err := resolveVersion(Config{VersionTemplate: "v1.{MISSING}.0"}, status)
+		assert.ErrorContains(t, err, "status key MISSING is not defined")
+	})
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+)
+
+const sbomToolName = "go_mod_tool"
+
+// sbomModule is a module listed in an SBOM.
+type sbomModule struct {
+	Path     string
+	Version  string
+	Indirect bool
+}
+
+// sbomInput is everything the SBOM writers need to know about a module archive.
+type sbomInput struct {
+	Module   sbomModule
+	Requires []sbomModule
+	Files    []archiveFile
+	Created  time.Time
+	// ZipSHA256 identifies this exact archive, it keeps SPDX document namespaces unique.
+	ZipSHA256 string
+}
+
+// newSBOMInput collects the requires of the archive's go.mod and its file
+// checksums. Files that appear more than once in the archive are listed once.
+func newSBOMInput(zipPath string, created time.Time) (*sbomInput, error) {
+	archive, err := readModuleArchive(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	zipDigest, err := sha256File(zipPath)
+	if err != nil {
+		return nil, err
+	}
+
+	mf, err := modfile.ParseLax("go.mod", archive.GoMod, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse go.mod of %s: %w", zipPath, err)
+	}
+
+	in := &sbomInput{
+		Module:    sbomModule{Path: archive.ModulePath, Version: archive.Version},
+		Created:   created.UTC(),
+		ZipSHA256: zipDigest,
+	}
+	for _, r := range mf.Require {
+		in.Requires = append(in.Requires, sbomModule{Path: r.Mod.Path, Version: r.Mod.Version, Indirect: r.Indirect})
+	}
+	sort.Slice(in.Requires, func(i, j int) bool { return in.Requires[i].Path < in.Requires[j].Path })
+
+	seen := map[string]bool{}
+	for _, f := range archive.Files {
+		if seen[f.Path] {
+			continue
+		}
+		seen[f.Path] = true
+		in.Files = append(in.Files, f)
+	}
+	sort.Slice(in.Files, func(i, j int) bool { return in.Files[i].Path < in.Files[j].Path })
+
+	return in, nil
+}
+
+func (m sbomModule) purl() string {
+	return "pkg:golang/" + m.Path + "@" + m.Version
+}
+
+func writeSBOMs(cfg Config, status map[string]string) error {
+	created, ok, err := buildTimestamp(status)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// unstamped builds have no BUILD_TIMESTAMP, use the epoch so the output stays reproducible
+		created = time.Unix(0, 0)
+	}
+	in, err := newSBOMInput(cfg.Output, created)
+	if err != nil {
+		return err
+	}
+
+	if cfg.SPDXOutput != "" {
+		if err := writeJSON(cfg.SPDXOutput, in.spdx()); err != nil {
+			return err
+		}
+	}
+	if cfg.CycloneDXOutput != "" {
+		if err := writeJSON(cfg.CycloneDXOutput, in.cycloneDX()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// SPDX 2.3, see: https://spdx.github.io/spdx-spec/v2.3/
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name                    string                       `json:"name"`
+	SPDXID                  string                       `json:"SPDXID"`
+	VersionInfo             string                       `json:"versionInfo"`
+	DownloadLocation        string                       `json:"downloadLocation"`
+	FilesAnalyzed           bool                         `json:"filesAnalyzed"`
+	PackageVerificationCode *spdxPackageVerificationCode `json:"packageVerificationCode,omitempty"`
+	LicenseConcluded        string                       `json:"licenseConcluded"`
+	LicenseDeclared         string                       `json:"licenseDeclared"`
+	CopyrightText           string                       `json:"copyrightText"`
+	ExternalRefs            []spdxExternalRef            `json:"externalRefs"`
+}
+
+type spdxPackageVerificationCode struct {
+	Value string `json:"packageVerificationCodeValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxFile struct {
+	FileName         string         `json:"fileName"`
+	SPDXID           string         `json:"SPDXID"`
+	Checksums        []spdxChecksum `json:"checksums"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	CopyrightText    string         `json:"copyrightText"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+	Comment            string `json:"comment,omitempty"`
+}
+
+var spdxIDUnsafe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// spdxID returns the SPDX identifier of the element name of the given kind.
+// Names with characters an identifier can't hold get them replaced, plus a
+// digest of the name, so a/b.go and a-b.go stay different elements.
+func spdxID(kind, name string) string {
+	id := strings.Trim(spdxIDUnsafe.ReplaceAllString(name, "-"), "-")
+	if id != name {
+		sum := sha256.Sum256([]byte(name))
+		id += "-" + hex.EncodeToString(sum[:6])
+	}
+	return "SPDXRef-" + kind + "-" + id
+}
+
+func newSPDXPackage(m sbomModule, files []archiveFile) spdxPackage {
+	p := spdxPackage{
+		Name:             m.Path,
+		SPDXID:           spdxID("Package", m.Path),
+		VersionInfo:      m.Version,
+		DownloadLocation: "NOASSERTION",
+		LicenseConcluded: "NOASSERTION",
+		LicenseDeclared:  "NOASSERTION",
+		CopyrightText:    "NOASSERTION",
+		ExternalRefs: []spdxExternalRef{{
+			ReferenceCategory: "PACKAGE-MANAGER",
+			ReferenceType:     "purl",
+			ReferenceLocator:  m.purl(),
+		}},
+	}
+	if files != nil {
+		p.FilesAnalyzed = true
+		p.PackageVerificationCode = &spdxPackageVerificationCode{Value: spdxVerificationCode(files)}
+	}
+	return p
+}
+
+// spdxVerificationCode implements the package verification code algorithm:
+// the SHA1 of the sorted, concatenated SHA1s of every file in the package.
+func spdxVerificationCode(files []archiveFile) string {
+	sums := make([]string, 0, len(files))
+	for _, f := range files {
+		sums = append(sums, f.SHA1)
+	}
+	sort.Strings(sums)
+	h := sha1.Sum([]byte(strings.Join(sums, "")))
+	return hex.EncodeToString(h[:])
+}
+
+func (in *sbomInput) spdx() *spdxDocument {
+	name := in.Module.Path + "@" + in.Module.Version
+	root := newSPDXPackage(in.Module, in.Files)
+
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: "https://spdx.org/spdxdocs/" + sbomToolName + "/" + name + "-" + in.ZipSHA256,
+		CreationInfo: spdxCreationInfo{
+			Created:  in.Created.Format(time.RFC3339),
+			Creators: []string{"Tool: " + sbomToolName},
+		},
+		Packages: []spdxPackage{root},
+		Files:    []spdxFile{},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: root.SPDXID,
+		}},
+	}
+
+	for _, f := range in.Files {
+		file := spdxFile{
+			FileName: "./" + f.Path,
+			SPDXID:   spdxID("File", f.Path),
+			Checksums: []spdxChecksum{
+				{Algorithm: "SHA1", ChecksumValue: f.SHA1},
+				{Algorithm: "SHA256", ChecksumValue: f.SHA256},
+			},
+			LicenseConcluded: "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+		}
+		doc.Files = append(doc.Files, file)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      root.SPDXID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: file.SPDXID,
+		})
+	}
+
+	for _, r := range in.Requires {
+		dep := newSPDXPackage(r, nil)
+		doc.Packages = append(doc.Packages, dep)
+		rel := spdxRelationship{
+			SPDXElementID:      root.SPDXID,
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: dep.SPDXID,
+		}
+		if r.Indirect {
+			rel.Comment = "indirect"
+		}
+		doc.Relationships = append(doc.Relationships, rel)
+	}
+
+	return doc
+}
+
+// CycloneDX 1.5, see: https://cyclonedx.org/docs/1.5/json/
+
+type cycloneDXDocument struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     cycloneDXTools     `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTools struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	Type       string              `json:"type"`
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	Scope      string              `json:"scope,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Hashes     []cycloneDXHash     `json:"hashes,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func (in *sbomInput) cycloneDX() *cycloneDXDocument {
+	root := cycloneDXComponent{
+		Type:    "library",
+		BOMRef:  in.Module.purl(),
+		Name:    in.Module.Path,
+		Version: in.Module.Version,
+		PURL:    in.Module.purl(),
+	}
+
+	doc := &cycloneDXDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: in.Created.Format(time.RFC3339),
+			Tools: cycloneDXTools{Components: []cycloneDXComponent{{
+				Type: "application",
+				Name: sbomToolName,
+			}}},
+			Component: root,
+		},
+		Components:   []cycloneDXComponent{},
+		Dependencies: []cycloneDXDependency{},
+	}
+
+	// only direct requires are edges of the module itself, indirect ones are
+	// listed as components so the inventory is complete
+	direct := []string{}
+	for _, r := range in.Requires {
+		c := cycloneDXComponent{
+			Type:    "library",
+			BOMRef:  r.purl(),
+			Name:    r.Path,
+			Version: r.Version,
+			Scope:   "required",
+			PURL:    r.purl(),
+		}
+		if r.Indirect {
+			c.Properties = []cycloneDXProperty{{Name: "go.mod:indirect", Value: "true"}}
+		} else {
+			direct = append(direct, r.purl())
+		}
+		doc.Components = append(doc.Components, c)
+	}
+	doc.Dependencies = append(doc.Dependencies, cycloneDXDependency{Ref: root.BOMRef, DependsOn: direct})
+
+	for _, f := range in.Files {
+		doc.Components = append(doc.Components, cycloneDXComponent{
+			Type:   "file",
+			BOMRef: "file:" + f.Path,
+			Name:   f.Path,
+			Hashes: []cycloneDXHash{
+				{Alg: "SHA-1", Content: f.SHA1},
+				{Alg: "SHA-256", Content: f.SHA256},
+			},
+		})
+	}
+
+	return doc
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sbomTestGoMod = `module example.com/test
+
+go 1.23.3
+
+require (
+	example.com/direct v1.2.0
+	example.com/indirect v0.3.1 // indirect
+)
+`
+
+func TestWriteSBOMs(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	zipFile := filepath.Join(tmpDir, "out.zip")
+	writeTestZip(t, zipFile, map[string]string{
+		"example.com/test@v1.0.0/go.mod":  sbomTestGoMod,
+		"example.com/test@v1.0.0/test.go": "package test\n",
+	})
+
+	cfg := Config{
+		Output:          zipFile,
+		SPDXOutput:      filepath.Join(tmpDir, "out.spdx.json"),
+		CycloneDXOutput: filepath.Join(tmpDir, "out.cdx.json"),
+	}
+	require.NoError(t, writeSBOMs(cfg, map[string]string{"BUILD_TIMESTAMP": "1710936000"}))
+
+	t.Run("spdx", func(t *testing.T) {
+		data, err := os.ReadFile(cfg.SPDXOutput)
+		require.NoError(t, err)
+		var doc spdxDocument
+		require.NoError(t, json.Unmarshal(data, &doc))
+
+		assert.Equal(t, "SPDX-2.3", doc.SPDXVersion)
+		assert.Equal(t, "example.com/test@v1.0.0", doc.Name)
+		assert.Equal(t, "2024-03-20T12:00:00Z", doc.CreationInfo.Created)
+
+		require.Len(t, doc.Packages, 3)
+		root := doc.Packages[0]
+		assert.Equal(t, "example.com/test", root.Name)
+		assert.Equal(t, "v1.0.0", root.VersionInfo)
+		assert.True(t, root.FilesAnalyzed)
+		require.NotNil(t, root.PackageVerificationCode)
+		assert.Equal(t, "pkg:golang/example.com/direct@v1.2.0", doc.Packages[1].ExternalRefs[0].ReferenceLocator)
+		assert.Equal(t, "v0.3.1", doc.Packages[2].VersionInfo)
+
+		var fileNames []string
+		for _, f := range doc.Files {
+			fileNames = append(fileNames, f.FileName)
+			require.Len(t, f.Checksums, 2)
+			assert.Equal(t, "SHA1", f.Checksums[0].Algorithm)
+			assert.Len(t, f.Checksums[1].ChecksumValue, 64)
+		}
+		assert.Equal(t, []string{"./go.mod", "./test.go"}, fileNames)
+
+		assert.Contains(t, doc.Relationships, spdxRelationship{
+			SPDXElementID:      root.SPDXID,
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: spdxID("Package", "example.com/indirect"),
+			Comment:            "indirect",
+		})
+		assert.Contains(t, doc.Relationships, spdxRelationship{
+			SPDXElementID:      root.SPDXID,
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: "SPDXRef-File-test.go",
+		})
+	})
+
+	t.Run("cyclonedx", func(t *testing.T) {
+		data, err := os.ReadFile(cfg.CycloneDXOutput)
+		require.NoError(t, err)
+		var doc cycloneDXDocument
+		require.NoError(t, json.Unmarshal(data, &doc))
+
+		assert.Equal(t, "CycloneDX", doc.BOMFormat)
+		assert.Equal(t, "pkg:golang/example.com/test@v1.0.0", doc.Metadata.Component.PURL)
+		assert.Equal(t, []cycloneDXDependency{{
+			Ref:       "pkg:golang/example.com/test@v1.0.0",
+			DependsOn: []string{"pkg:golang/example.com/direct@v1.2.0"},
+		}}, doc.Dependencies)
+
+		var names []string
+		for _, c := range doc.Components {
+			names = append(names, c.Type+":"+c.Name)
+		}
+		assert.Equal(t, []string{
+			"library:example.com/direct",
+			"library:example.com/indirect",
+			"file:go.mod",
+			"file:test.go",
+		}, names)
+		assert.Equal(t, []cycloneDXProperty{{Name: "go.mod:indirect", Value: "true"}}, doc.Components[1].Properties)
+	})
+}
+
+func TestNewSBOMInputListsDuplicateFilesOnce(t *testing.T) {
+	zipFile := filepath.Join(t.TempDir(), "out.zip")
+	// go.mod is passed both via --go-mod and as part of the srcs filegroup
+	tmpDir := filepath.Dir(zipFile)
+	goMod := filepath.Join(tmpDir, "go.mod")
+	require.NoError(t, os.WriteFile(goMod, []byte("module example.com/test\n"), 0644))
+	cfg := Config{Output: zipFile, GoMod: goMod, SrcFiles: []string{goMod}, StripPrefix: tmpDir}
+	require.NoError(t, writeModuleZip(cfg, "example.com/test@v1.0.0"))
+
+	in, err := newSBOMInput(zipFile, time.Unix(0, 0))
+	require.NoError(t, err)
+	require.Len(t, in.Files, 1)
+	assert.Equal(t, "go.mod", in.Files[0].Path)
+	assert.Empty(t, in.Requires)
+}
+
+func TestSPDXID(t *testing.T) {
+	assert.Equal(t, "SPDXRef-File-go.mod", spdxID("File", "go.mod"))
+	assert.Equal(t, "SPDXRef-File-a-b.go", spdxID("File", "a-b.go"))
+
+	// names that only differ in characters an identifier can't hold
+	ids := map[string]string{}
+	for _, name := range []string{"a-b.go", "a/b.go", "a_b.go", "a b.go", "a//b.go"} {
+		id := spdxID("File", name)
+		assert.Regexp(t, `^SPDXRef-[A-Za-z0-9.-]+$`, id)
+		if other, ok := ids[id]; ok {
+			t.Errorf("%s and %s share the SPDX ID %s", other, name, id)
+		}
+		ids[id] = name
+	}
+}
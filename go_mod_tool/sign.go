@@ -0,0 +1,228 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+)
+
+// signatureHeader is the first line of every signed note, so a signature for
+// something else signed by the same key can't be mistaken for an archive signature.
+const signatureHeader = "go_mod_tool archive signature"
+
+type SignConfig struct {
+	Zip           string
+	SigningKey    string
+	SigningKeyEnv string
+	Output        string
+}
+
+type VerifySignatureConfig struct {
+	Zip         string
+	Mod         string
+	Signature   string
+	TrustedKeys []string
+}
+
+type GenerateKeyConfig struct {
+	Name             string
+	PrivateKeyOutput string
+	PublicKeyOutput  string
+}
+
+// archiveHashes holds the go.sum style hashes of a module archive.
+type archiveHashes struct {
+	ModulePath string
+	Version    string
+	ZipHash    string
+	ModHash    string
+}
+
+// noteText renders the hashes in the same shape as go.sum lines.
+func (h archiveHashes) noteText() string {
+	return fmt.Sprintf("%s\n%s %s %s\n%s %s/go.mod %s\n",
+		signatureHeader,
+		h.ModulePath, h.Version, h.ZipHash,
+		h.ModulePath, h.Version, h.ModHash,
+	)
+}
+
+// hashArchive computes the zip and go.mod hashes of a module archive. If mod
+// is non-empty it is hashed instead of the go.mod inside the archive, which is
+// how a proxy serves the .mod file next to the .zip.
+func hashArchive(zipPath, mod string) (archiveHashes, error) {
+	var h archiveHashes
+
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return h, err
+	}
+	defer zr.Close()
+
+	h.ModulePath, h.Version, err = archiveModuleVersion(&zr.Reader)
+	if err != nil {
+		return h, err
+	}
+
+	var modData []byte
+	if mod != "" {
+		modData, err = os.ReadFile(mod)
+	} else {
+		modData, err = readZipFile(&zr.Reader, h.ModulePath+"@"+h.Version+"/go.mod")
+	}
+	if err != nil {
+		return h, err
+	}
+
+	h.ZipHash, err = dirhash.HashZip(zipPath, dirhash.Hash1)
+	if err != nil {
+		return h, err
+	}
+	h.ModHash, err = dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(modData)), nil
+	})
+	if err != nil {
+		return h, err
+	}
+	return h, nil
+}
+
+// readSigningKey returns the note private key from the file or the
+// environment variable cfg names.
+func readSigningKey(cfg SignConfig) (string, error) {
+	if cfg.SigningKeyEnv != "" {
+		skey := strings.TrimSpace(os.Getenv(cfg.SigningKeyEnv))
+		if skey == "" {
+			return "", fmt.Errorf("$%s holds no signing key", cfg.SigningKeyEnv)
+		}
+		return skey, nil
+	}
+	skey, err := os.ReadFile(cfg.SigningKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read signing key %s: %w", cfg.SigningKey, err)
+	}
+	return strings.TrimSpace(string(skey)), nil
+}
+
+// writeArchiveSignature signs the hashes of zipPath with the note private key
+// skey and writes the signed note to output.
+func writeArchiveSignature(zipPath, skey, output string) error {
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		return fmt.Errorf("invalid signing key: %w", err)
+	}
+
+	h, err := hashArchive(zipPath, "")
+	if err != nil {
+		return err
+	}
+
+	msg, err := note.Sign(&note.Note{Text: h.noteText()}, signer)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, msg, 0644)
+}
+
+// runSign signs a built archive. It runs outside of bazel, e.g. in the CI job
+// that publishes the archives, so the private key is never an action input
+// that could be copied to a remote executor or cache.
+func runSign(cfg SignConfig) error {
+	skey, err := readSigningKey(cfg)
+	if err != nil {
+		return err
+	}
+	if err := writeArchiveSignature(cfg.Zip, skey, cfg.Output); err != nil {
+		return fmt.Errorf("failed to sign %s: %w", cfg.Zip, err)
+	}
+	return nil
+}
+
+// readTrustedKeys reads note verifier keys, one per line. Blank lines and lines
+// starting with # are ignored.
+func readTrustedKeys(paths []string) (note.Verifiers, error) {
+	var verifiers []note.Verifier
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trusted keys %s: %w", p, err)
+		}
+		scanner := bufio.NewScanner(f)
+		lineNo := 0
+		for scanner.Scan() {
+			lineNo++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			v, err := note.NewVerifier(line)
+			if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s:%d: invalid verifier key: %w", p, lineNo, err)
+			}
+			verifiers = append(verifiers, v)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trusted keys %s: %w", p, err)
+		}
+	}
+	if len(verifiers) == 0 {
+		return nil, fmt.Errorf("no trusted keys found")
+	}
+	return note.VerifierList(verifiers...), nil
+}
+
+// verifyArchiveSignature checks that signature was produced by one of the
+// trusted keys and that it covers exactly the given archive (and .mod file).
+func verifyArchiveSignature(zipPath, mod string, signature []byte, trusted note.Verifiers) error {
+	n, err := note.Open(signature, trusted)
+	if err != nil {
+		return fmt.Errorf("signature rejected: %w", err)
+	}
+
+	h, err := hashArchive(zipPath, mod)
+	if err != nil {
+		return err
+	}
+	if n.Text != h.noteText() {
+		return fmt.Errorf("signature does not match %s@%s: archive or go.mod was modified", h.ModulePath, h.Version)
+	}
+	return nil
+}
+
+func runVerifySignature(cfg VerifySignatureConfig, out io.Writer) error {
+	trusted, err := readTrustedKeys(cfg.TrustedKeys)
+	if err != nil {
+		return err
+	}
+	signature, err := os.ReadFile(cfg.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to read signature %s: %w", cfg.Signature, err)
+	}
+	if err := verifyArchiveSignature(cfg.Zip, cfg.Mod, signature, trusted); err != nil {
+		return fmt.Errorf("%s: %w", cfg.Zip, err)
+	}
+	fmt.Fprintf(out, "%s: signature OK\n", cfg.Zip)
+	return nil
+}
+
+func runGenerateKey(cfg GenerateKeyConfig) error {
+	skey, vkey, err := note.GenerateKey(rand.Reader, cfg.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(cfg.PrivateKeyOutput, []byte(skey+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(cfg.PublicKeyOutput, []byte(vkey+"\n"), 0644)
+}
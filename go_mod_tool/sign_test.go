@@ -0,0 +1,168 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func writeTestZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func TestArchiveSignature(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	skey, vkey, err := note.GenerateKey(rand.Reader, "ci.example.com")
+	require.NoError(t, err)
+	keyFile := filepath.Join(tmpDir, "signing.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(skey+"\n"), 0600))
+	trustedFile := filepath.Join(tmpDir, "trusted.keys")
+	require.NoError(t, os.WriteFile(trustedFile, []byte("# CI\n"+vkey+"\n"), 0644))
+
+	_, otherVkey, err := note.GenerateKey(rand.Reader, "someone.else")
+	require.NoError(t, err)
+	untrustedFile := filepath.Join(tmpDir, "untrusted.keys")
+	require.NoError(t, os.WriteFile(untrustedFile, []byte(otherVkey+"\n"), 0644))
+
+	files := map[string]string{
+		"example.com/test@v1.0.0/go.mod":  "module example.com/test\n",
+		"example.com/test@v1.0.0/test.go": "package test\n",
+	}
+	zipFile := filepath.Join(tmpDir, "test.zip")
+	writeTestZip(t, zipFile, files)
+
+	sigFile := filepath.Join(tmpDir, "test.sig")
+	require.NoError(t, runSign(SignConfig{Zip: zipFile, SigningKey: keyFile, Output: sigFile}))
+
+	sig, err := os.ReadFile(sigFile)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(sig), signatureHeader+"\nexample.com/test v1.0.0 h1:"))
+	assert.Contains(t, string(sig), "\nexample.com/test v1.0.0/go.mod h1:")
+
+	t.Run("valid signature", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		err := runVerifySignature(VerifySignatureConfig{
+			Zip:         zipFile,
+			Signature:   sigFile,
+			TrustedKeys: []string{trustedFile},
+		}, out)
+		require.NoError(t, err)
+		assert.Contains(t, out.String(), "signature OK")
+	})
+
+	t.Run("matching .mod file", func(t *testing.T) {
+		modFile := filepath.Join(tmpDir, "v1.0.0.mod")
+		require.NoError(t, os.WriteFile(modFile, []byte("module example.com/test\n"), 0644))
+		trusted, err := readTrustedKeys([]string{trustedFile})
+		require.NoError(t, err)
+		assert.NoError(t, verifyArchiveSignature(zipFile, modFile, sig, trusted))
+	})
+
+	t.Run("tampered .mod file", func(t *testing.T) {
+		modFile := filepath.Join(tmpDir, "tampered.mod")
+		require.NoError(t, os.WriteFile(modFile, []byte("module example.com/test\nrequire evil.com/x v1.0.0\n"), 0644))
+		trusted, err := readTrustedKeys([]string{trustedFile})
+		require.NoError(t, err)
+		assert.ErrorContains(t, verifyArchiveSignature(zipFile, modFile, sig, trusted), "was modified")
+	})
+
+	t.Run("tampered archive", func(t *testing.T) {
+		tampered := map[string]string{
+			"example.com/test@v1.0.0/go.mod":  "module example.com/test\n",
+			"example.com/test@v1.0.0/test.go": "package test\n\nfunc Evil() {}\n",
+		}
+		tamperedZip := filepath.Join(tmpDir, "tampered.zip")
+		writeTestZip(t, tamperedZip, tampered)
+
+		trusted, err := readTrustedKeys([]string{trustedFile})
+		require.NoError(t, err)
+		assert.ErrorContains(t, verifyArchiveSignature(tamperedZip, "", sig, trusted), "was modified")
+	})
+
+	t.Run("untrusted key", func(t *testing.T) {
+		trusted, err := readTrustedKeys([]string{untrustedFile})
+		require.NoError(t, err)
+		assert.ErrorContains(t, verifyArchiveSignature(zipFile, "", sig, trusted), "signature rejected")
+	})
+
+	t.Run("unsigned archive", func(t *testing.T) {
+		trusted, err := readTrustedKeys([]string{trustedFile})
+		require.NoError(t, err)
+		assert.Error(t, verifyArchiveSignature(zipFile, "", []byte("not a signature\n"), trusted))
+	})
+
+	t.Run("key from the environment", func(t *testing.T) {
+		t.Setenv("GO_MOD_TOOL_TEST_SIGNING_KEY", skey)
+		envSig := filepath.Join(tmpDir, "env.sig")
+		require.NoError(t, runSign(SignConfig{Zip: zipFile, SigningKeyEnv: "GO_MOD_TOOL_TEST_SIGNING_KEY", Output: envSig}))
+
+		trusted, err := readTrustedKeys([]string{trustedFile})
+		require.NoError(t, err)
+		sig, err := os.ReadFile(envSig)
+		require.NoError(t, err)
+		assert.NoError(t, verifyArchiveSignature(zipFile, "", sig, trusted))
+	})
+
+	t.Run("empty key variable", func(t *testing.T) {
+		t.Setenv("GO_MOD_TOOL_TEST_SIGNING_KEY", "")
+		err := runSign(SignConfig{Zip: zipFile, SigningKeyEnv: "GO_MOD_TOOL_TEST_SIGNING_KEY", Output: filepath.Join(tmpDir, "empty.sig")})
+		assert.ErrorContains(t, err, "$GO_MOD_TOOL_TEST_SIGNING_KEY holds no signing key")
+	})
+}
+
+func TestReadTrustedKeys(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Run("invalid key names the line", func(t *testing.T) {
+		keys := filepath.Join(tmpDir, "bad.keys")
+		require.NoError(t, os.WriteFile(keys, []byte("# comment\n\nnot-a-key\n"), 0644))
+		_, err := readTrustedKeys([]string{keys})
+		assert.ErrorContains(t, err, "bad.keys:3")
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		keys := filepath.Join(tmpDir, "empty.keys")
+		require.NoError(t, os.WriteFile(keys, []byte("# nothing here\n"), 0644))
+		_, err := readTrustedKeys([]string{keys})
+		assert.ErrorContains(t, err, "no trusted keys")
+	})
+}
+
+func TestRunGenerateKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := GenerateKeyConfig{
+		Name:             "ci.example.com",
+		PrivateKeyOutput: filepath.Join(tmpDir, "key"),
+		PublicKeyOutput:  filepath.Join(tmpDir, "key.pub"),
+	}
+	require.NoError(t, runGenerateKey(cfg))
+
+	skey, err := os.ReadFile(cfg.PrivateKeyOutput)
+	require.NoError(t, err)
+	_, err = note.NewSigner(strings.TrimSpace(string(skey)))
+	assert.NoError(t, err)
+
+	vkey, err := os.ReadFile(cfg.PublicKeyOutput)
+	require.NoError(t, err)
+	_, err = note.NewVerifier(strings.TrimSpace(string(vkey)))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+type StampConfig struct {
+	Input              string
+	Output             string
+	Manifest           string
+	VolatileStatusFile string
+	StableStatusFile   string
+	StrictStatus       bool
+	VersionTemplate    string
+	Label              string
+	ProvenanceOutput   string
+	SPDXOutput         string
+	CycloneDXOutput    string
+}
+
+// runStamp turns an unstamped content archive into the module archive of a
+// specific version. Only the version depends on the status files or the
+// manifest, so the content archive stays cacheable and stamping is cheap:
+// entries are copied without being decompressed, and only go.mod is rewritten.
+func runStamp(cfg StampConfig) error {
+	zr, err := zip.OpenReader(cfg.Input)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	modulePath, contentVersion, err := archiveModuleVersion(&zr.Reader)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cfg.Input, err)
+	}
+
+	status, err := readStatusFiles(cfg.StableStatusFile, cfg.VolatileStatusFile, statusFileOptions{
+		DisallowDuplicates: cfg.StrictStatus,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to parse status files: %w", err)
+	}
+
+	var manifest *versionManifest
+	var version string
+	if cfg.Manifest != "" {
+		if manifest, err = readManifest(cfg.Manifest); err != nil {
+			return err
+		}
+		v, ok := manifest.version(modulePath)
+		if !ok {
+			return fmt.Errorf("%s has no version for %s", cfg.Manifest, modulePath)
+		}
+		version = v
+	} else if version, err = resolveVersion(Config{VersionTemplate: cfg.VersionTemplate}, status); err != nil {
+		return err
+	}
+
+	oldPrefix := modulePath + "@" + contentVersion + "/"
+	newPrefix := modulePath + "@" + version + "/"
+	if err := writeStampedZip(&zr.Reader, cfg.Output, oldPrefix, newPrefix, manifest); err != nil {
+		return fmt.Errorf("failed to stamp %s: %w", cfg.Input, err)
+	}
+
+	return writeAttestations(Config{
+		Output:           cfg.Output,
+		ModulePath:       modulePath,
+		Label:            cfg.Label,
+		ProvenanceOutput: cfg.ProvenanceOutput,
+		SPDXOutput:       cfg.SPDXOutput,
+		CycloneDXOutput:  cfg.CycloneDXOutput,
+	}, version, status, func() ([]resourceDescriptor, error) {
+		return archiveDependencies(cfg.Input)
+	})
+}
+
+// writeStampedZip copies every entry of zr to output with oldPrefix replaced
+// by newPrefix. Entries are copied raw, still compressed. go.mod is the one
+// exception: with a manifest, its requirements on other released modules are
+// pinned to their manifest versions.
+func writeStampedZip(zr *zip.Reader, output, oldPrefix, newPrefix string, manifest *versionManifest) error {
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	zw := zip.NewWriter(out)
+
+	for _, f := range zr.File {
+		name := newPrefix + strings.TrimPrefix(f.Name, oldPrefix)
+		if name == newPrefix+"go.mod" && manifest != nil {
+			if err := writeStampedGoMod(zw, f, name, manifest); err != nil {
+				return err
+			}
+			continue
+		}
+
+		header := f.FileHeader
+		header.Name = name
+		w, err := zw.CreateRaw(&header)
+		if err != nil {
+			return err
+		}
+		r, err := f.OpenRaw()
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", f.Name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func writeStampedGoMod(zw *zip.Writer, f *zip.File, name string, manifest *versionManifest) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	stamped, err := stampGoMod(f.Name, data, manifest)
+	if err != nil {
+		return err
+	}
+
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: f.Modified}
+	header.SetMode(f.Mode())
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(stamped)
+	return err
+}
+
+// stampGoMod pins the requirements on modules in the manifest to their
+// manifest versions, and drops the replace directives pointing them at local
+// directories: consumers of the published module fetch them from the proxy.
+func stampGoMod(name string, data []byte, manifest *versionManifest) ([]byte, error) {
+	f, err := modfile.Parse(name, data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range f.Require {
+		if v, ok := manifest.version(r.Mod.Path); ok && v != r.Mod.Version {
+			if err := f.AddRequire(r.Mod.Path, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, r := range append([]*modfile.Replace(nil), f.Replace...) {
+		if _, ok := manifest.version(r.Old.Path); ok && modfile.IsDirectoryPath(r.New.Path) {
+			if err := f.DropReplace(r.Old.Path, r.Old.Version); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	f.Cleanup()
+	return modfile.Format(f.Syntax), nil
+}
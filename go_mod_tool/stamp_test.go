@@ -0,0 +1,142 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readZipEntries(t *testing.T, path string) map[string]string {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer zr.Close()
+
+	entries := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		_, dup := entries[f.Name]
+		require.False(t, dup, "duplicate entry %s", f.Name)
+		entries[f.Name] = string(data)
+	}
+	return entries
+}
+
+func TestRunStamp(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	goMod := `module example.com/app
+
+go 1.22
+
+require (
+	example.com/lib v0.0.0
+	github.com/external/dep v1.5.0
+)
+
+replace example.com/lib => ../lib
+`
+	src := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "cmd"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "go.mod"), []byte(goMod), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "app.go"), []byte("package app\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "cmd", "main.go"), []byte("package main\n"), 0644))
+
+	// the content archive is built without status files, like the go_mod rule does
+	content := filepath.Join(tmpDir, "content.zip")
+	require.NoError(t, run(Config{
+		Output:      content,
+		ModulePath:  "example.com/app",
+		GoMod:       filepath.Join(src, "go.mod"),
+		SrcFiles:    []string{filepath.Join(src, "go.mod"), filepath.Join(src, "app.go"), filepath.Join(src, "cmd", "main.go")},
+		StripPrefix: src,
+	}))
+
+	t.Run("from manifest", func(t *testing.T) {
+		manifest := filepath.Join(tmpDir, "manifest.json")
+		require.NoError(t, writeManifest(manifest, &versionManifest{Modules: []manifestEntry{
+			{Path: "example.com/app", Version: "v0.4.1"},
+			{Path: "example.com/lib", Version: "v1.3.0"},
+		}}))
+
+		output := filepath.Join(tmpDir, "manifest.zip")
+		require.NoError(t, runStamp(StampConfig{
+			Input:            content,
+			Output:           output,
+			Manifest:         manifest,
+			Label:            "//app:go_mod_zip",
+			ProvenanceOutput: filepath.Join(tmpDir, "manifest.provenance.json"),
+		}))
+
+		assert.Equal(t, map[string]string{
+			"example.com/app@v0.4.1/go.mod": `module example.com/app
+
+go 1.22
+
+require (
+	example.com/lib v1.3.0
+	github.com/external/dep v1.5.0
+)
+`,
+			"example.com/app@v0.4.1/app.go":      "package app\n",
+			"example.com/app@v0.4.1/cmd/main.go": "package main\n",
+		}, readZipEntries(t, output))
+
+		h, err := hashArchive(output, "")
+		require.NoError(t, err)
+		assert.Equal(t, "v0.4.1", h.Version)
+
+		provenance, err := os.ReadFile(filepath.Join(tmpDir, "manifest.provenance.json"))
+		require.NoError(t, err)
+		assert.Contains(t, string(provenance), filepath.ToSlash(content))
+	})
+
+	t.Run("from status", func(t *testing.T) {
+		status := filepath.Join(tmpDir, "volatile-status.txt")
+		require.NoError(t, os.WriteFile(status, []byte("VOLATILE_VERSION v0.0.0-1710936000\n"), 0644))
+
+		output := filepath.Join(tmpDir, "status.zip")
+		require.NoError(t, runStamp(StampConfig{Input: content, Output: output, VolatileStatusFile: status}))
+
+		entries := readZipEntries(t, output)
+		assert.Equal(t, goMod, entries["example.com/app@v0.0.0-1710936000/go.mod"])
+		assert.Len(t, entries, 3)
+	})
+
+	t.Run("copies entries raw", func(t *testing.T) {
+		output := filepath.Join(tmpDir, "raw.zip")
+		status := filepath.Join(tmpDir, "volatile-status.txt")
+		require.NoError(t, runStamp(StampConfig{Input: content, Output: output, VolatileStatusFile: status}))
+
+		in, err := zip.OpenReader(content)
+		require.NoError(t, err)
+		defer in.Close()
+		out, err := zip.OpenReader(output)
+		require.NoError(t, err)
+		defer out.Close()
+
+		compressed := map[string]uint64{}
+		for _, f := range in.File {
+			compressed[f.Name[len("example.com/app@__unversioned__/"):]] = f.CompressedSize64
+		}
+		for _, f := range out.File {
+			assert.Equal(t, compressed[f.Name[len("example.com/app@v0.0.0-1710936000/"):]], f.CompressedSize64, f.Name)
+		}
+	})
+
+	t.Run("module missing from manifest", func(t *testing.T) {
+		manifest := filepath.Join(tmpDir, "other.json")
+		require.NoError(t, writeManifest(manifest, &versionManifest{}))
+		err := runStamp(StampConfig{Input: content, Output: filepath.Join(tmpDir, "missing.zip"), Manifest: manifest})
+		assert.ErrorContains(t, err, "has no version for example.com/app")
+	})
+}
@@ -0,0 +1,3 @@
+module example.com/repo/foo/bar
+
+go 1.23.3
@@ -0,0 +1,7 @@
+module example.com/repo/mod_a/nested
+
+go 1.23.3
+
+require example.com/repo/mod_a v0.0.0
+
+replace example.com/repo/mod_a => ../
@@ -0,0 +1,3 @@
+module example.com/repo/mod_b
+
+go 1.23.3
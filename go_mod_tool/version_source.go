@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// versionSource is an authoritative record of which module versions have been
+// published. Planning and publishing ask it for the current version of a
+// module, whichever backend keeps that record.
+type versionSource interface {
+	// Versions returns the published versions of modulePath sorted by
+	// semver, or none when the module was never published.
+	Versions(modulePath string) ([]string, error)
+}
+
+// latestVersion returns the highest version of modulePath published to src,
+// or "" when there is none.
+func latestVersion(src versionSource, modulePath string) (string, error) {
+	versions, err := src.Versions(modulePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to list versions of %s: %w", modulePath, err)
+	}
+	if len(versions) == 0 {
+		return "", nil
+	}
+	return versions[len(versions)-1], nil
+}
+
+// newVersionSource creates a version source from a "kind:location" spec:
+//
+//	manifest:<path>   a version manifest (see versionManifest)
+//	goproxy:<url>     a GOPROXY server, queried with <url>/<module>/@v/list
+//	git:<repo>        semver tags in a local git repository, prefixed with
+//	                  the module's directory as the go command expects
+func newVersionSource(spec, goModTarget string) (versionSource, error) {
+	kind, location, ok := strings.Cut(spec, ":")
+	if !ok || location == "" {
+		return nil, fmt.Errorf("invalid version source %q, expected manifest:<path>, goproxy:<url> or git:<repo>", spec)
+	}
+	switch kind {
+	case "manifest":
+		return newManifestSource(location)
+	case "goproxy":
+		return newGoproxySource(location), nil
+	case "git":
+		return newGitTagSource(location, goModTarget)
+	default:
+		return nil, fmt.Errorf("unknown version source %q, expected manifest, goproxy or git", kind)
+	}
+}
+
+// manifestSource reads versions from a version manifest, which records a
+// single current version per module.
+type manifestSource struct {
+	manifest *versionManifest
+}
+
+func newManifestSource(path string) (*manifestSource, error) {
+	m, err := readManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	return &manifestSource{manifest: m}, nil
+}
+
+func (s *manifestSource) Versions(modulePath string) ([]string, error) {
+	if v, ok := s.manifest.version(modulePath); ok {
+		return []string{v}, nil
+	}
+	return nil, nil
+}
+
+// goproxySource lists versions with the GOPROXY protocol's $base/$module/@v/list.
+type goproxySource struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newGoproxySource(baseURL string) *goproxySource {
+	return &goproxySource{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *goproxySource) Versions(modulePath string) ([]string, error) {
+	escaped, err := module.EscapePath(modulePath)
+	if err != nil {
+		return nil, err
+	}
+	url := s.baseURL + "/" + escaped + "/@v/list"
+	resp, err := s.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// proxies answer 404 or 410 for modules they don't know
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("GET %s: %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var versions []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if v := strings.TrimSpace(scanner.Text()); semver.IsValid(v) {
+			versions = append(versions, v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("GET %s: %w", url, err)
+	}
+	semver.Sort(versions)
+	return versions, nil
+}
+
+// gitTagSource reads versions from the tags of a local git repository. A
+// module in directory lib is tagged lib/v1.2.3, the root module v1.2.3.
+type gitTagSource struct {
+	repoRoot string
+	modules  []*repoModule
+}
+
+func newGitTagSource(repoRoot, goModTarget string) (*gitTagSource, error) {
+	modules, err := findRepoModules(repoRoot, goModTarget)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find modules in %s: %w", repoRoot, err)
+	}
+	return &gitTagSource{repoRoot: repoRoot, modules: modules}, nil
+}
+
+func (s *gitTagSource) Versions(modulePath string) ([]string, error) {
+	var m *repoModule
+	for _, candidate := range s.modules {
+		if candidate.Path == modulePath {
+			m = candidate
+			break
+		}
+	}
+	if m == nil {
+		return nil, fmt.Errorf("module %s is not in %s", modulePath, s.repoRoot)
+	}
+
+	prefix := ""
+	if m.Dir != "." {
+		prefix = m.Dir + "/"
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "-C", s.repoRoot, "tag", "--list", prefix+"v*")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git tag failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var versions []string
+	for _, tag := range strings.Fields(string(out)) {
+		v := strings.TrimPrefix(tag, prefix)
+		// the pattern also matches tags of nested modules, e.g. lib/vendor/v1.0.0
+		if semver.IsValid(v) && !strings.Contains(v, "/") {
+			versions = append(versions, v)
+		}
+	}
+	semver.Sort(versions)
+	return versions, nil
+}
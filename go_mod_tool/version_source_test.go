@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewVersionSource(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{"goproxy:https://proxy.golang.org", ""},
+		{"manifest:", `invalid version source "manifest:"`},
+		{"manifest.json", `invalid version source "manifest.json"`},
+		{"s3:bucket", `unknown version source "s3"`},
+		{"manifest:does-not-exist.json", "failed to read manifest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := newVersionSource(tt.spec, defaultGoModTarget)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManifestSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, writeManifest(path, &versionManifest{Modules: []manifestEntry{
+		{Path: "example.com/lib", Version: "v1.2.3"},
+	}}))
+
+	src, err := newVersionSource("manifest:"+path, defaultGoModTarget)
+	require.NoError(t, err)
+
+	latest, err := latestVersion(src, "example.com/lib")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.3", latest)
+
+	latest, err = latestVersion(src, "example.com/other")
+	require.NoError(t, err)
+	assert.Equal(t, "", latest)
+}
+
+func TestGoproxySource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/example.com/!my!lib/@v/list":
+			w.Write([]byte("v1.10.0\nv1.2.0\n\nnot-a-version\nv1.9.0-rc.1\n"))
+		case "/example.com/broken/@v/list":
+			http.Error(w, "upstream unavailable", http.StatusBadGateway)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	src := newGoproxySource(server.URL + "/")
+
+	versions, err := src.Versions("example.com/MyLib")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.2.0", "v1.9.0-rc.1", "v1.10.0"}, versions)
+
+	versions, err = src.Versions("example.com/unknown")
+	require.NoError(t, err)
+	assert.Empty(t, versions)
+
+	_, err = src.Versions("example.com/broken")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "502 Bad Gateway: upstream unavailable")
+}
+
+func TestGitTagSource(t *testing.T) {
+	dir, git := gitRepo(t)
+	commitFile(t, git, dir, "go.mod", "module example.com/root\n", "chore: add root")
+	commitFile(t, git, dir, "lib/go.mod", "module example.com/lib\n", "chore: add lib")
+	commitFile(t, git, dir, "lib/nested/go.mod", "module example.com/lib/nested\n", "chore: add nested")
+	for _, tag := range []string{"v0.1.0", "lib/v1.0.0", "lib/v1.10.0", "lib/v1.2.0", "lib/nested/v3.0.0", "lib/latest", "other/v9.0.0"} {
+		git("tag", tag)
+	}
+
+	src, err := newVersionSource("git:"+dir, defaultGoModTarget)
+	require.NoError(t, err)
+
+	tests := []struct {
+		module string
+		want   []string
+	}{
+		{"example.com/root", []string{"v0.1.0"}},
+		{"example.com/lib", []string{"v1.0.0", "v1.2.0", "v1.10.0"}},
+		{"example.com/lib/nested", []string{"v3.0.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.module, func(t *testing.T) {
+			versions, err := src.Versions(tt.module)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, versions)
+		})
+	}
+
+	_, err = src.Versions("example.com/elsewhere")
+	assert.ErrorContains(t, err, "module example.com/elsewhere is not in")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// placeholderPattern matches {KEY} and {KEY:N}, where N truncates the value to
+// its first N characters (e.g. {STABLE_GIT_COMMIT:12}).
+var placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// expandVersionTemplate fills in a version template such as
+// "v0.0.0-{BUILD_TIMESTAMP}-{STABLE_GIT_COMMIT:12}" from status file keys and
+// checks that the result is a canonical semantic version.
+func expandVersionTemplate(tmpl string, status map[string]string) (string, error) {
+	var errs []string
+
+	version := placeholderPattern.ReplaceAllStringFunc(tmpl, func(placeholder string) string {
+		key, length, hasLength := strings.Cut(placeholder[1:len(placeholder)-1], ":")
+		if !statusKeyPattern.MatchString(key) {
+			errs = append(errs, fmt.Sprintf("invalid placeholder %s", placeholder))
+			return ""
+		}
+
+		value, ok := status[key]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("status key %s is not defined", key))
+			return ""
+		}
+
+		if hasLength {
+			n, err := strconv.Atoi(length)
+			if err != nil || n <= 0 {
+				errs = append(errs, fmt.Sprintf("invalid length in placeholder %s", placeholder))
+				return ""
+			}
+			if len(value) > n {
+				value = value[:n]
+			}
+		}
+		return value
+	})
+	if len(errs) > 0 {
+		return "", fmt.Errorf("version template %q: %s", tmpl, strings.Join(errs, "; "))
+	}
+
+	if strings.ContainsAny(version, "{}") {
+		return "", fmt.Errorf("version template %q: unbalanced braces", tmpl)
+	}
+	if !semver.IsValid(version) || semver.Canonical(version) != version {
+		return "", fmt.Errorf("version template %q: %q is not a canonical semantic version (vMAJOR.MINOR.PATCH[-PRERELEASE])", tmpl, version)
+	}
+	return version, nil
+}
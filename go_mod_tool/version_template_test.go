@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandVersionTemplate(t *testing.T) {
+	status := map[string]string{
+		"BUILD_NUMBER":      "42",
+		"BUILD_TIMESTAMP":   "1710936000",
+		"STABLE_GIT_COMMIT": "0123456789abcdef0123",
+		"BUILD_USER":        "some user",
+	}
+
+	tests := []struct {
+		name    string
+		tmpl    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "no placeholders",
+			tmpl: "v1.2.3",
+			want: "v1.2.3",
+		},
+		{
+			name: "single key",
+			tmpl: "v1.{BUILD_NUMBER}.0",
+			want: "v1.42.0",
+		},
+		{
+			name: "truncated key",
+			tmpl: "v0.0.0-{BUILD_TIMESTAMP}-{STABLE_GIT_COMMIT:12}",
+			want: "v0.0.0-1710936000-0123456789ab",
+		},
+		{
+			name: "length longer than value",
+			tmpl: "v1.{BUILD_NUMBER:8}.0",
+			want: "v1.42.0",
+		},
+		{
+			name:    "undefined key",
+			tmpl:    "v1.{BUILD_NUMBER}.{PATCH}",
+			wantErr: "status key PATCH is not defined",
+		},
+		{
+			name:    "invalid length",
+			tmpl:    "v1.{BUILD_NUMBER:x}.0",
+			wantErr: "invalid length in placeholder {BUILD_NUMBER:x}",
+		},
+		{
+			name:    "invalid placeholder",
+			tmpl:    "v1.{}.0",
+			wantErr: "invalid placeholder {}",
+		},
+		{
+			name:    "unbalanced braces",
+			tmpl:    "v1.{BUILD_NUMBER.0",
+			wantErr: "unbalanced braces",
+		},
+		{
+			name:    "not semver",
+			tmpl:    "1.{BUILD_NUMBER}.0",
+			wantErr: "not a canonical semantic version",
+		},
+		{
+			name:    "value breaks semver",
+			tmpl:    "v1.0.0-{BUILD_USER}",
+			wantErr: "not a canonical semantic version",
+		},
+		{
+			name:    "build metadata is not allowed",
+			tmpl:    "v1.0.0+{BUILD_NUMBER}",
+			wantErr: "not a canonical semantic version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandVersionTemplate(tt.tmpl, status)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -1,6 +1,17 @@
 load("@rules_go//go:def.bzl", "GoInfo")
 load("@aspect_bazel_lib//lib:stamping.bzl", "STAMP_ATTRS", "maybe_stamp")
 
+GoModInfo = provider(
+    doc = "A Go module archived by a go_mod rule",
+    fields = {
+        "module_path": "The module path",
+        "zip": "The stamped module archive",
+        "srcs": "depset of the files the archive was built from",
+        "strip_prefix": "The prefix stripped from srcs paths",
+        "exclude": "The exclude globs applied to srcs",
+    },
+)
+
 def _go_mod_archive_impl(ctx):
     go_mod = ctx.file.go_mod
     module_path = ctx.attr.module_path
@@ -13,38 +24,89 @@ def _go_mod_archive_impl(ctx):
     if not all_srcs:
         fail("No .go source files found in srcs: %s" % ctx.attr.srcs)
 
-    output_zip = ctx.actions.declare_file(ctx.attr.name + ".zip")
-
-    # Collect all inputs: go.mod, stamp file (if any), and all srcs
-    inputs = [go_mod]
-    stamp = maybe_stamp(ctx)
-    if stamp:
-        inputs.append(stamp.volatile_status_file)
-    all_inputs = depset(inputs, transitive=[all_srcs])
-
+    # Phase 1: the content archive only depends on the sources, so it stays
+    # cached across builds whatever the version ends up being.
+    content_zip = ctx.actions.declare_file(ctx.attr.name + ".content.zip")
     go_mod_tool = ctx.executable._go_mod_tool
 
     args = ctx.actions.args()
     args.add("--strip-prefix", ctx.label.package)
-    args.add("--output", output_zip.path)
+    args.add("--output", content_zip.path)
     args.add("--module-path", module_path)
     args.add("--go-mod", go_mod.path)
-    if stamp:
-        args.add("--volatile-status-file", stamp.volatile_status_file.path)
+    args.add_all(ctx.attr.exclude, before_each="--exclude")
 
     # If you need to pass all srcs as arguments, you must convert to a list
     for src in all_srcs.to_list():
         args.add("--src", src.path)
 
     ctx.actions.run(
-        outputs=[output_zip],
-        inputs=all_inputs,
+        outputs=[content_zip],
+        inputs=depset([go_mod], transitive=[all_srcs]),
         executable=go_mod_tool,
         arguments=[args],
-        progress_message="Creating Go module archive %s" % ctx.label,
+        progress_message="Creating Go module content archive %s" % ctx.label,
+    )
+
+    # Phase 2: stamping copies the compressed entries under the versioned
+    # prefix and rewrites go.mod, which is cheap enough to redo on every
+    # version change.
+    output_zip = ctx.actions.declare_file(ctx.attr.name + ".zip")
+    inputs = [content_zip]
+
+    stamp_args = ctx.actions.args()
+    stamp_args.add("stamp")
+    stamp_args.add("--input", content_zip.path)
+    stamp_args.add("--output", output_zip.path)
+    stamp = maybe_stamp(ctx)
+    if stamp:
+        inputs.append(stamp.stable_status_file)
+        inputs.append(stamp.volatile_status_file)
+        stamp_args.add("--stable-status-file", stamp.stable_status_file.path)
+        stamp_args.add("--volatile-status-file", stamp.volatile_status_file.path)
+    if ctx.file.version_manifest:
+        inputs.append(ctx.file.version_manifest)
+        stamp_args.add("--manifest", ctx.file.version_manifest.path)
+    if ctx.attr.version_template:
+        stamp_args.add("--version-template", ctx.attr.version_template)
+
+    provenance = ctx.actions.declare_file(ctx.attr.name + ".provenance.json")
+    stamp_args.add("--label", str(ctx.label))
+    stamp_args.add("--provenance-output", provenance.path)
+
+    spdx = ctx.actions.declare_file(ctx.attr.name + ".spdx.json")
+    cyclonedx = ctx.actions.declare_file(ctx.attr.name + ".cdx.json")
+    stamp_args.add("--spdx-output", spdx.path)
+    stamp_args.add("--cyclonedx-output", cyclonedx.path)
+
+    outputs = [output_zip, provenance, spdx, cyclonedx]
+    output_groups = {
+        "content": depset([content_zip]),
+        "provenance": depset([provenance]),
+        "sbom": depset([spdx, cyclonedx]),
+    }
+
+    ctx.actions.run(
+        outputs=outputs,
+        inputs=inputs,
+        executable=go_mod_tool,
+        arguments=[stamp_args],
+        progress_message="Stamping Go module archive %s" % ctx.label,
     )
 
-    return [DefaultInfo(files=depset([output_zip]))]
+    # extra outputs live in output groups so $(location) of the rule still
+    # resolves to the single .zip
+    return [
+        DefaultInfo(files=depset([output_zip])),
+        OutputGroupInfo(**output_groups),
+        GoModInfo(
+            module_path=module_path,
+            zip=output_zip,
+            srcs=all_srcs,
+            strip_prefix=ctx.label.package,
+            exclude=ctx.attr.exclude,
+        ),
+    ]
 
 _go_mod = rule(
   implementation = _go_mod_archive_impl,
@@ -65,6 +127,20 @@ _go_mod = rule(
       mandatory = True,
       doc = "The module path (e.g., github.com/my_project)",
     ),
+    "exclude": attr.string_list(
+      doc = "Globs of module relative paths to leave out of the archive; matching a directory excludes everything below it",
+    ),
+    "deps": attr.label_list(
+      providers = [GoModInfo],
+      doc = "go_mod targets of the in-repo modules this module's go.mod requires",
+    ),
+    "version_template": attr.string(
+      doc = "Module version built from status keys, e.g. v0.0.0-{BUILD_TIMESTAMP}-{STABLE_GIT_COMMIT:12}. Defaults to the VOLATILE_VERSION key",
+    ),
+    "version_manifest": attr.label(
+      allow_single_file = [".json"],
+      doc = "A version manifest; when set, the module's version and its in-repo requirements' versions come from it",
+    ),
     "_go_mod_tool": attr.label(
       default = "//go_mod_tool:go_mod_tool",
       executable = True,
@@ -75,11 +151,67 @@ _go_mod = rule(
   doc = "Creates a Go module archive (.zip) for use with a Go proxy",
 )
 
-def go_mod(name, go_mod, srcs, module_path, visibility = None):
+def go_mod(name, go_mod, srcs, module_path, deps = None, exclude = None, version_template = None, version_manifest = None, visibility = None):
   _go_mod(
     name = name,
     go_mod = go_mod,
     srcs = srcs,
     module_path = module_path,
+    deps = deps,
+    exclude = exclude,
+    version_template = version_template,
+    version_manifest = version_manifest,
     visibility = visibility
   )
+
+def _shell_quote(s):
+    return "'" + s.replace("'", "'\\''") + "'"
+
+def _go_mod_test_impl(ctx):
+    info = ctx.attr.go_mod[GoModInfo]
+    go_mod_tool = ctx.executable._go_mod_tool
+
+    # the checker only compares names, so the srcs are passed the way the
+    # archive action saw them and don't need to be in the runfiles
+    args = [
+        "check-archive",
+        "--zip", info.zip.short_path,
+        "--module-path", info.module_path,
+        "--strip-prefix", info.strip_prefix,
+    ]
+    for pattern in info.exclude:
+        args.extend(["--exclude", pattern])
+    for src in info.srcs.to_list():
+        args.extend(["--src", src.path])
+
+    script = ctx.actions.declare_file(ctx.label.name + ".sh")
+    ctx.actions.write(
+        output=script,
+        content="#!/usr/bin/env bash\nexec {} {}\n".format(
+            _shell_quote(go_mod_tool.short_path),
+            " ".join([_shell_quote(arg) for arg in args]),
+        ),
+        is_executable=True,
+    )
+
+    runfiles = ctx.runfiles(files=[info.zip, go_mod_tool])
+    runfiles = runfiles.merge(ctx.attr._go_mod_tool[DefaultInfo].default_runfiles)
+    return [DefaultInfo(executable=script, runfiles=runfiles)]
+
+go_mod_test = rule(
+  implementation = _go_mod_test_impl,
+  test = True,
+  attrs = {
+    "go_mod": attr.label(
+      mandatory = True,
+      providers = [GoModInfo],
+      doc = "The go_mod target whose archive to check",
+    ),
+    "_go_mod_tool": attr.label(
+      default = "//go_mod_tool:go_mod_tool",
+      executable = True,
+      cfg = "target",
+    ),
+  },
+  doc = "Checks a go_mod archive: its files are the rule's srcs, go.mod declares the module path, and it holds no duplicate entries or Bazel files",
+)
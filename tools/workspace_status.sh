@@ -1,2 +1,6 @@
 #!/bin/bash
+# Keys starting with STABLE_ end up in bazel-out/stable-status.txt, everything
+# else in volatile-status.txt. Any of them can be used in a go_mod
+# version_template, e.g. "v0.0.0-{BUILD_TIMESTAMP}-{STABLE_GIT_COMMIT:12}".
+echo "STABLE_GIT_COMMIT $(git rev-parse HEAD 2>/dev/null || echo unknown)"
 echo "VOLATILE_VERSION v0.1.0-$(date +%s)"